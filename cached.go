@@ -0,0 +1,335 @@
+package eternal
+
+import (
+	"cmp"
+	"container/list"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// CachePolicy
+// Determines when nodes persisted to CachedStorage are written to underlying storage.
+type CachePolicy uint8
+
+const (
+	// WriteThrough writes persisted nodes to underlying storage immediately.
+	WriteThrough CachePolicy = iota
+	// WriteBack writes persisted nodes to underlying storage when they are evicted from cache or on Flush.
+	// Changes held in cache are lost on crash, Flush should be called before underlying storage is closed.
+	// If underlying storage implements AtomicStorage, nodes are written at the end of every tree operation.
+	WriteBack
+)
+
+// CacheStats
+// Counters of CachedStorage.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+	// Nodes is number of currently cached nodes
+	Nodes int
+}
+
+// CachedStorage
+// NodeStorage keeping the least recently used nodes of underlying storage in memory, so frequently visited nodes
+// (root and upper levels) are not loaded and decoded again.
+// If underlying storage is changed directly (e.g. defragmented), Purge must be called.
+type CachedStorage[K cmp.Ordered, V any] struct {
+	lock       sync.Mutex
+	underlying NodeStorage[K, V]
+	capacity   int
+	policy     CachePolicy
+	entries    *list.List // front is the most recently used node
+	byId       map[uint]*list.Element
+	rootId     *uint
+	stats      CacheStats
+}
+
+type cacheEntry[K cmp.Ordered, V any] struct {
+	node  Node[K, V]
+	dirty bool
+}
+
+var (
+	_ NodeStorage[string, any] = &CachedStorage[string, any]{}
+	_ AtomicStorage            = &CachedStorage[string, any]{}
+	_ DurableStorage           = &CachedStorage[string, any]{}
+	_ CountingStorage          = &CachedStorage[string, any]{}
+)
+
+// NewCachedStorage
+// Wraps storage by cache holding at most capacity nodes.
+func NewCachedStorage[K cmp.Ordered, V any](
+	underlying NodeStorage[K, V], capacity int, policy CachePolicy,
+) (*CachedStorage[K, V], error) {
+	if capacity < 1 {
+		return nil, errors.New("cache must hold at least one node")
+	}
+	return &CachedStorage[K, V]{
+		underlying: underlying,
+		capacity:   capacity,
+		policy:     policy,
+		entries:    list.New(),
+		byId:       make(map[uint]*list.Element, capacity),
+	}, nil
+}
+
+func (c *CachedStorage[K, V]) GetRoot() (Node[K, V], error) {
+	c.lock.Lock()
+	rootId := c.rootId
+	c.lock.Unlock()
+	if rootId != nil {
+		return c.Get(*rootId)
+	}
+	root, err := c.underlying.GetRoot()
+	if err != nil {
+		return Node[K, V]{}, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// root id does not change, tree always stores new root under the old id
+	c.rootId = &root.id
+	if _, cached := c.byId[root.id]; cached {
+		// cached version can be newer than the persisted one
+		c.stats.Hits++
+		return c.touch(root.id).clone(), nil
+	}
+	c.stats.Misses++
+	return root.clone(), c.put(root, false)
+}
+
+func (c *CachedStorage[K, V]) GetDepth() uint {
+	return c.underlying.GetDepth()
+}
+
+func (c *CachedStorage[K, V]) SetDepth(depth uint) error {
+	return c.underlying.SetDepth(depth)
+}
+
+func (c *CachedStorage[K, V]) Get(id uint) (Node[K, V], error) {
+	c.lock.Lock()
+	if _, cached := c.byId[id]; cached {
+		c.stats.Hits++
+		node := c.touch(id).clone()
+		c.lock.Unlock()
+		return node, nil
+	}
+	c.stats.Misses++
+	c.lock.Unlock()
+
+	// other reads can continue while node is loaded
+	node, err := c.underlying.Get(id)
+	if err != nil {
+		return Node[K, V]{}, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, cached := c.byId[id]; cached {
+		// node was loaded or persisted in the meantime
+		return c.touch(id).clone(), nil
+	}
+	return node.clone(), c.put(node, false)
+}
+
+func (c *CachedStorage[K, V]) Persist(node Node[K, V]) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.policy == WriteThrough {
+		if err := c.underlying.Persist(node); err != nil {
+			// cached version may not correspond to the stored one anymore
+			c.drop(node.id)
+			return err
+		}
+	}
+	return c.put(node.clone(), c.policy == WriteBack)
+}
+
+func (c *CachedStorage[K, V]) Remove(id uint) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drop(id)
+	return c.underlying.Remove(id)
+}
+
+func (c *CachedStorage[K, V]) NewId() (uint, error) {
+	return c.underlying.NewId()
+}
+
+func (c *CachedStorage[K, V]) CheckValue(key K, value V) error {
+	return checkValue(c.underlying, key, value)
+}
+
+// Flush
+// Writes all changed nodes to underlying storage.
+func (c *CachedStorage[K, V]) Flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.flush()
+}
+
+// Purge
+// Removes all nodes from cache. Changed nodes are written to underlying storage firstly.
+func (c *CachedStorage[K, V]) Purge() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.flush(); err != nil {
+		return err
+	}
+	c.purge()
+	return nil
+}
+
+// CountsSubtrees
+// See CountingStorage, underlying storage decides.
+func (c *CachedStorage[K, V]) CountsSubtrees() bool {
+	return countsSubtrees(c.underlying)
+}
+
+// Stats
+// Returns current values of cache counters.
+func (c *CachedStorage[K, V]) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.stats
+	stats.Nodes = c.entries.Len()
+	return stats
+}
+
+// Sync
+// Flushes changed nodes and syncs underlying storage, if it implements DurableStorage.
+func (c *CachedStorage[K, V]) Sync() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	if durableStorage, ok := c.underlying.(DurableStorage); ok {
+		return durableStorage.Sync()
+	}
+	return nil
+}
+
+// Close
+// Flushes changed nodes and closes underlying storage, if it can be closed.
+func (c *CachedStorage[K, V]) Close() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	if closer, ok := c.underlying.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Begin
+// Starts batch in underlying storage, if it implements AtomicStorage.
+func (c *CachedStorage[K, V]) Begin() error {
+	atomicStorage, ok := c.underlying.(AtomicStorage)
+	if !ok {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// batch must contain only changes of the current operation
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return atomicStorage.Begin()
+}
+
+// Commit
+// Writes changed nodes to the batch of underlying storage and commits it. When batch cannot be committed, all cached
+// nodes are dropped, as some of them could be changed in the batch.
+func (c *CachedStorage[K, V]) Commit() error {
+	atomicStorage, ok := c.underlying.(AtomicStorage)
+	if !ok {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.flush(); err != nil {
+		c.purge()
+		return errors.Join(err, atomicStorage.Rollback())
+	}
+	if err := atomicStorage.Commit(); err != nil {
+		c.purge()
+		return err
+	}
+	return nil
+}
+
+// Rollback
+// Rolls back batch of underlying storage and drops all cached nodes, as some of them could be changed in the batch.
+func (c *CachedStorage[K, V]) Rollback() error {
+	atomicStorage, ok := c.underlying.(AtomicStorage)
+	if !ok {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// nodes were flushed at the beginning of the batch, no change is lost
+	c.purge()
+	return atomicStorage.Rollback()
+}
+
+// touch
+// Marks node as the most recently used and returns it. Node must be cached.
+func (c *CachedStorage[K, V]) touch(id uint) Node[K, V] {
+	element := c.byId[id]
+	c.entries.MoveToFront(element)
+	return element.Value.(*cacheEntry[K, V]).node
+}
+
+// put
+// Stores node to cache and evicts the least recently used node if cache is full.
+func (c *CachedStorage[K, V]) put(node Node[K, V], dirty bool) error {
+	if element, cached := c.byId[node.id]; cached {
+		entry := element.Value.(*cacheEntry[K, V])
+		entry.node = node
+		entry.dirty = entry.dirty || dirty
+		c.entries.MoveToFront(element)
+		return nil
+	}
+	c.byId[node.id] = c.entries.PushFront(&cacheEntry[K, V]{node: node, dirty: dirty})
+	if c.entries.Len() <= c.capacity {
+		return nil
+	}
+	evicted := c.entries.Back()
+	entry := evicted.Value.(*cacheEntry[K, V])
+	if entry.dirty {
+		// node must stay cached until it is written, otherwise it could be loaded in its old version
+		if err := c.underlying.Persist(entry.node); err != nil {
+			return err
+		}
+	}
+	c.entries.Remove(evicted)
+	delete(c.byId, entry.node.id)
+	c.stats.Evictions++
+	return nil
+}
+
+func (c *CachedStorage[K, V]) drop(id uint) {
+	if element, cached := c.byId[id]; cached {
+		c.entries.Remove(element)
+		delete(c.byId, id)
+	}
+}
+
+func (c *CachedStorage[K, V]) flush() error {
+	// persist in order of ids, so writes to files are sequential
+	for _, id := range slices.Sorted(maps.Keys(c.byId)) {
+		entry := c.byId[id].Value.(*cacheEntry[K, V])
+		if !entry.dirty {
+			continue
+		}
+		if err := c.underlying.Persist(entry.node); err != nil {
+			return err
+		}
+		entry.dirty = false
+	}
+	return nil
+}
+
+func (c *CachedStorage[K, V]) purge() {
+	c.entries.Init()
+	clear(c.byId)
+}
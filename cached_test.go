@@ -0,0 +1,126 @@
+package eternal
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedStorage(t *testing.T) {
+	t.Parallel()
+	const a, b = 3, 5
+	for name, policy := range map[string]CachePolicy{"write through": WriteThrough, "write back": WriteBack} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			underlying, _ := createPersistentStorage(t, a, b)
+			storage, err := NewCachedStorage[int64, int64](underlying, 8, policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := NewTree[int64, int64](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			random := rand.New(rand.NewSource(42))
+			expected := make(map[int64]int64)
+			for i := 0; i < 1000; i++ {
+				key := random.Int63n(300)
+				if random.Intn(3) == 0 {
+					assert.NoError(t, tree.Delete(key))
+					delete(expected, key)
+				} else {
+					assert.NoError(t, tree.Insert(key, int64(i)))
+					expected[key] = int64(i)
+				}
+			}
+			for key, expectedValue := range expected {
+				value, err := tree.Get(key)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedValue, value)
+			}
+			stats := storage.Stats()
+			assert.NotZero(t, stats.Hits)
+			assert.NotZero(t, stats.Misses)
+			assert.NotZero(t, stats.Evictions)
+			assert.LessOrEqual(t, stats.Nodes, 8)
+
+			// after flush, underlying storage must contain the whole tree
+			assert.NoError(t, storage.Flush())
+			(&treeChecker[int64, int64]{
+				testing:            t,
+				storage:            underlying,
+				a:                  a,
+				b:                  b,
+				checkedNodes:       make(map[uint]struct{}),
+				expectedValueCount: len(expected),
+			}).checkTree()
+			assert.NoError(t, storage.Purge())
+			assert.Zero(t, storage.Stats().Nodes)
+		})
+	}
+}
+
+func TestCachedStorage_Rollback(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	log := createTempFile(t, "log")
+	underlying, _ := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	storage, err := NewCachedStorage[int64, int64](underlying, 100, WriteBack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 10; i++ {
+		assert.NoError(t, tree.Insert(i, i))
+	}
+	assert.NoError(t, storage.Begin())
+	assert.NoError(t, tree.insert(100, 100))
+	assert.NoError(t, storage.Rollback())
+	tree.depth = storage.GetDepth()
+	_, err = tree.Get(100)
+	assert.ErrorIs(t, err, ErrNotFound)
+	for i := int64(0); i < 10; i++ {
+		value, err := tree.Get(i)
+		assert.NoError(t, err)
+		assert.Equal(t, i, value)
+	}
+}
+
+func TestCachedStorage_FailedCommit(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	log := &failingSyncFile{}
+	underlying, _ := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	storage, err := NewCachedStorage[int64, int64](underlying, 100, WriteBack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 10; i++ {
+		assert.NoError(t, tree.Insert(i, i))
+	}
+	log.failing = true
+	assert.Error(t, tree.Insert(100, 100))
+	log.failing = false
+	// cache must not keep nodes of batch which was not committed
+	_, err = tree.Get(100)
+	assert.ErrorIs(t, err, ErrNotFound)
+	for i := int64(0); i < 10; i++ {
+		value, err := tree.Get(i)
+		assert.NoError(t, err)
+		assert.Equal(t, i, value)
+	}
+	assert.NoError(t, tree.Insert(100, 100))
+	report, err := underlying.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+}
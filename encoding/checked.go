@@ -0,0 +1,95 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrValueTooLarge is returned from Serializer.SerializeChecked if string or slice is longer than its declared length
+var ErrValueTooLarge = errors.New("value exceeds declared length")
+
+// ValueTooLargeError
+// Describes string or slice, which would be truncated by Serializer.Serialize. Matches ErrValueTooLarge.
+type ValueTooLargeError struct {
+	// Path to the value from serialized type, e.g. "Second.Tags[2]", empty for the type itself
+	Path string
+	// Length is length of the value, bytes for strings and elements for slices
+	Length uint
+	// Limit is declared length
+	Limit uint
+}
+
+func (v *ValueTooLargeError) Error() string {
+	return fmt.Sprintf("%s has length %d, declared length is %d", pathOrValue(v.Path), v.Length, v.Limit)
+}
+
+func (v *ValueTooLargeError) Is(target error) bool {
+	return target == ErrValueTooLarge
+}
+
+// SerializeChecked
+// Serializes value the same way as Serialize, but returns ValueTooLargeError instead of truncating strings and slices
+// longer than their declared length.
+func (s Serializer[T]) SerializeChecked(value T) ([]byte, error) {
+	if err := s.Check(value); err != nil {
+		return nil, err
+	}
+	return s.Serialize(value), nil
+}
+
+// Check
+// Returns ValueTooLargeError for the first string or slice in value, which would be truncated by Serialize.
+func (s Serializer[T]) Check(value T) error {
+	return checkValue(s.blueprint, reflect.ValueOf(value), "")
+}
+
+func checkValue(blueprint blueprint, value reflect.Value, path string) error {
+	switch blueprint := blueprint.(type) {
+	case stringBlueprint:
+		if length := uint(value.Len()); length > uint(blueprint.length) {
+			return &ValueTooLargeError{Path: path, Length: length, Limit: uint(blueprint.length)}
+		}
+	case sliceBlueprint:
+		if length := uint(value.Len()); length > uint(blueprint.length) {
+			return &ValueTooLargeError{Path: path, Length: length, Limit: uint(blueprint.length)}
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := checkValue(blueprint.element, value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case arrayBlueprint:
+		for i := 0; i < value.Len(); i++ {
+			if err := checkValue(blueprint.element, value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case pointerBlueprint:
+		if value.IsNil() {
+			return nil
+		}
+		return checkValue(blueprint.element, value.Elem(), path)
+	case structBlueprint:
+		for _, field := range blueprint.fields {
+			name := joinPath(path, blueprint.structType.Field(field.fieldIndex).Name)
+			if err := checkValue(field.blueprint, value.Field(field.fieldIndex), name); err != nil {
+				return err
+			}
+		}
+	case tupleBlueprint:
+		if err := checkValue(blueprint.first, value.Field(0), joinPath(path, "First")); err != nil {
+			return err
+		}
+		return checkValue(blueprint.second, value.Field(1), joinPath(path, "Second"))
+	}
+	// remaining blueprints have fixed size and cannot be truncated
+	return nil
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
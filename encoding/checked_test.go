@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializer_SerializeChecked(t *testing.T) {
+	t.Parallel()
+	type address struct {
+		Street string `eternal:"size=4"`
+	}
+	type person struct {
+		Name      string   `eternal:"size=3"`
+		Tags      []string `eternal:"size=2;elementSize=2"`
+		Addresses [2]address
+		Manager   *address
+		Ignored   string `eternal:"ignored"`
+	}
+	serializer, err := Create[person]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tupleSerializer := CreateForTuple(CreateForPrimitive[int](), serializer)
+	type Scenario struct {
+		Name          string
+		Value         person
+		ExpectedError *ValueTooLargeError
+	}
+	scenarios := []Scenario{
+		{Name: "fits", Value: person{Name: "abc", Tags: []string{"ab", ""}, Ignored: "not checked"}},
+		{Name: "multibyte string", Value: person{Name: "žž"}, ExpectedError: &ValueTooLargeError{Path: "Name", Length: 4, Limit: 3}},
+		{Name: "long slice", Value: person{Tags: []string{"a", "b", "c"}}, ExpectedError: &ValueTooLargeError{Path: "Tags", Length: 3, Limit: 2}},
+		{Name: "long element", Value: person{Tags: []string{"a", "bcd"}}, ExpectedError: &ValueTooLargeError{Path: "Tags[1]", Length: 3, Limit: 2}},
+		{
+			Name:          "array of structs",
+			Value:         person{Addresses: [2]address{{}, {Street: "street"}}},
+			ExpectedError: &ValueTooLargeError{Path: "Addresses[1].Street", Length: 6, Limit: 4},
+		},
+		{
+			Name:          "pointer",
+			Value:         person{Manager: &address{Street: "street"}},
+			ExpectedError: &ValueTooLargeError{Path: "Manager.Street", Length: 6, Limit: 4},
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			data, err := serializer.SerializeChecked(scenario.Value)
+			if scenario.ExpectedError == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, serializer.Serialize(scenario.Value), data)
+				return
+			}
+			assert.ErrorIs(t, err, ErrValueTooLarge)
+			assert.Equal(t, scenario.ExpectedError, err)
+			assert.Nil(t, data)
+
+			err = tupleSerializer.Check(Tuple[int, person]{First: 1, Second: scenario.Value})
+			expected := *scenario.ExpectedError
+			expected.Path = "Second." + expected.Path
+			assert.Equal(t, &expected, err)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package encoding
+
+import (
+	"fmt"
+	"math"
+)
+
+// Decoder
+// Decodes serialized values described by Schema without the Go type they were created from.
+// Values are decoded to:
+//   - bool, int8-int64, uint8-uint64, float32, float64, complex64 and complex128 according to kind and bits
+//   - string for strings
+//   - []any for slices and arrays
+//   - nil or decoded value for pointers
+//   - map[string]any by field name for structs, tuples have fields First and Second
+type Decoder struct {
+	schema   Schema
+	variable bool
+}
+
+// CreateDecoder
+// Creates decoder of values serialized by Serializer with given schema.
+func CreateDecoder(schema Schema) (Decoder, error) {
+	if err := validateSchema(schema, false); err != nil {
+		return Decoder{}, err
+	}
+	return Decoder{schema: schema}, nil
+}
+
+// CreateVariableDecoder
+// Creates decoder of values serialized by VariableSerializer with given schema.
+func CreateVariableDecoder(schema Schema) (Decoder, error) {
+	if err := validateSchema(schema, true); err != nil {
+		return Decoder{}, err
+	}
+	return Decoder{schema: schema, variable: true}, nil
+}
+
+// Schema
+// Returns schema of decoded values.
+func (d Decoder) Schema() Schema {
+	return d.schema
+}
+
+// Decode
+// Decodes value from the beginning of data.
+func (d Decoder) Decode(data []byte) (any, error) {
+	if !d.variable {
+		if uint(len(data)) < d.schema.Size() {
+			return nil, ErrTruncatedData
+		}
+		return decodeFixed(d.schema, data), nil
+	}
+	value, _, err := decodeVariable(d.schema, data)
+	return value, err
+}
+
+func validateSchema(schema Schema, variable bool) error {
+	switch schema.Kind {
+	case KindBool:
+		return nil
+	case KindInt, KindUint, KindFloat, KindComplex:
+		if !validBits(schema.Kind, schema.Bits) {
+			return fmt.Errorf("%w: %s cannot have %d bits", ErrInvalidSchema, schema.Kind, schema.Bits)
+		}
+		return nil
+	case KindString, KindSlice:
+		if variable != (schema.Length == 0) {
+			return fmt.Errorf("%w: length of %s does not match serializer", ErrInvalidSchema, schema.Kind)
+		}
+		if schema.Kind == KindString {
+			return nil
+		}
+		fallthrough
+	case KindArray, KindPointer:
+		if schema.Element == nil {
+			return fmt.Errorf("%w: %s must have element", ErrInvalidSchema, schema.Kind)
+		}
+		return validateSchema(*schema.Element, variable)
+	case KindStruct, KindTuple:
+		if schema.Kind == KindTuple && len(schema.Fields) != 2 {
+			return fmt.Errorf("%w: tuple must have two fields", ErrInvalidSchema)
+		}
+		for _, field := range schema.Fields {
+			if err := validateSchema(field.Schema, variable); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown %s", ErrInvalidSchema, schema.Kind)
+	}
+}
+
+// decodeFixed
+// Decodes value of fixed size schema, data have at least schema.Size() bytes.
+func decodeFixed(schema Schema, data []byte) any {
+	switch schema.Kind {
+	case KindBool:
+		return data[0] != 0
+	case KindInt, KindUint, KindFloat, KindComplex:
+		return decodeNumber(schema, data)
+	case KindString:
+		length := min(toUint32(data), schema.Length)
+		return string(data[4 : 4+length])
+	case KindSlice:
+		length := min(toUint32(data), schema.Length)
+		return decodeFixedElements(*schema.Element, data[4:], length)
+	case KindArray:
+		return decodeFixedElements(*schema.Element, data, schema.Length)
+	case KindPointer:
+		if data[0] == nilPointer {
+			return nil
+		}
+		return decodeFixed(*schema.Element, data[pointerSize:])
+	default: // KindStruct, KindTuple
+		fields := make(map[string]any, len(schema.Fields))
+		var offset uint
+		for _, field := range schema.Fields {
+			fields[field.Name] = decodeFixed(field.Schema, data[offset:])
+			offset += field.Schema.Size()
+		}
+		return fields
+	}
+}
+
+func decodeFixedElements(element Schema, data []byte, length uint32) []any {
+	elements := make([]any, length)
+	size := element.Size()
+	for i := range elements {
+		elements[i] = decodeFixed(element, data[uint(i)*size:])
+	}
+	return elements
+}
+
+// decodeVariable
+// Decodes value serialized by VariableSerializer and returns number of read bytes.
+func decodeVariable(schema Schema, data []byte) (any, int, error) {
+	switch schema.Kind {
+	case KindBool, KindInt, KindUint, KindFloat, KindComplex:
+		size := int(schema.Size())
+		if len(data) < size {
+			return nil, 0, ErrTruncatedData
+		}
+		return decodeFixed(schema, data), size, nil
+	case KindString:
+		length, read, err := readLength(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data)-read < length {
+			return nil, 0, ErrTruncatedData
+		}
+		return string(data[read : read+length]), read + length, nil
+	case KindSlice, KindArray:
+		length, read := int(schema.Length), 0
+		if schema.Kind == KindSlice {
+			var err error
+			if length, read, err = readLength(data); err != nil {
+				return nil, 0, err
+			}
+		}
+		elements := make([]any, length)
+		for i := range elements {
+			element, elementRead, err := decodeVariable(*schema.Element, data[read:])
+			if err != nil {
+				return nil, 0, err
+			}
+			elements[i] = element
+			read += elementRead
+		}
+		return elements, read, nil
+	case KindPointer:
+		if len(data) == 0 {
+			return nil, 0, ErrTruncatedData
+		}
+		if data[0] == nilPointer {
+			return nil, 1, nil
+		}
+		element, read, err := decodeVariable(*schema.Element, data[1:])
+		return element, read + 1, err
+	default: // KindStruct, KindTuple
+		fields := make(map[string]any, len(schema.Fields))
+		var read int
+		for _, field := range schema.Fields {
+			value, fieldRead, err := decodeVariable(field.Schema, data[read:])
+			if err != nil {
+				return nil, 0, err
+			}
+			fields[field.Name] = value
+			read += fieldRead
+		}
+		return fields, read, nil
+	}
+}
+
+func decodeNumber(schema Schema, data []byte) any {
+	switch schema.Kind {
+	case KindInt:
+		switch schema.Bits {
+		case 8:
+			return int8(toUint8(data))
+		case 16:
+			return int16(toUint16(data))
+		case 32:
+			return int32(toUint32(data))
+		default:
+			return int64(toUint64(data))
+		}
+	case KindUint:
+		switch schema.Bits {
+		case 8:
+			return toUint8(data)
+		case 16:
+			return toUint16(data)
+		case 32:
+			return toUint32(data)
+		default:
+			return toUint64(data)
+		}
+	case KindFloat:
+		if schema.Bits == 32 {
+			return math.Float32frombits(toUint32(data))
+		}
+		return math.Float64frombits(toUint64(data))
+	default: // KindComplex
+		if schema.Bits == 64 {
+			return complex(math.Float32frombits(toUint32(data)), math.Float32frombits(toUint32(data[4:])))
+		}
+		return complex(math.Float64frombits(toUint64(data)), math.Float64frombits(toUint64(data[8:])))
+	}
+}
@@ -0,0 +1,72 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+	type item struct {
+		Label  string `eternal:"size=4"`
+		Amount uint16
+	}
+	type order struct {
+		Id      int64
+		Paid    bool
+		Ratio   float32
+		Point   complex64
+		Items   []item `eternal:"size=3"`
+		Codes   [2]int8
+		Parent  *int32
+		Missing *int32
+	}
+	value := order{
+		Id: -3, Paid: true, Ratio: 0.5, Point: complex(1, -1), Items: []item{{Label: "ab", Amount: 7}},
+		Codes: [2]int8{-1, 1}, Parent: pointer[int32](9),
+	}
+	expected := map[string]any{
+		"Id": int64(-3), "Paid": true, "Ratio": float32(0.5), "Point": complex64(complex(1, -1)),
+		"Items":  []any{map[string]any{"Label": "ab", "Amount": uint16(7)}},
+		"Codes":  []any{int8(-1), int8(1)},
+		"Parent": int32(9), "Missing": nil,
+	}
+
+	serializer, err := Create[order]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := CreateDecoder(serializer.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decoder.Decode(serializer.Serialize(value))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decoded)
+	_, err = decoder.Decode(make([]byte, serializer.Size()-1))
+	assert.ErrorIs(t, err, ErrTruncatedData)
+
+	variableSerializer, err := CreateVariable[order]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	variableDecoder, err := CreateVariableDecoder(variableSerializer.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := variableSerializer.Serialize(value)
+	decoded, err = variableDecoder.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decoded)
+	_, err = variableDecoder.Decode(data[:len(data)-1])
+	assert.ErrorIs(t, err, ErrTruncatedData)
+
+	// schema of the other serializer is rejected
+	_, err = CreateDecoder(variableSerializer.Schema())
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+	_, err = CreateVariableDecoder(serializer.Schema())
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+	_, err = CreateDecoder(Schema{Kind: KindSlice, Length: 2})
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+}
@@ -3,7 +3,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"go/format"
 	"os"
 )
 
@@ -116,12 +118,9 @@ func handleWriteError(err error) {
 }
 
 func main() {
-	file, err := os.Create("schema_gen.go")
-	if err != nil {
-		fmt.Printf("error occured when creating schema_gen.go file: %s", err)
-		os.Exit(1)
-	}
-	_, err = file.WriteString(header)
+	// code is generated to buffer and formatted before it is written, so generated file is gofmt clean
+	file := &bytes.Buffer{}
+	_, err := file.WriteString(header)
 	handleWriteError(err)
 	for _, size := range intSizes {
 		generateConvertFunctions(file, size)
@@ -142,9 +141,15 @@ func main() {
 		_, err := file.WriteString(fmt.Sprintf(complexTemplate, size, sizeInBytes, floatSize))
 		handleWriteError(err)
 	}
+	formatted, err := format.Source(file.Bytes())
+	if err != nil {
+		fmt.Printf("error occured when formatting schema_gen.go file: %s", err)
+		os.Exit(1)
+	}
+	handleWriteError(os.WriteFile("schema_gen.go", formatted, 0644))
 }
 
-func generateConvertFunctions(file *os.File, bitSize uint) {
+func generateConvertFunctions(file *bytes.Buffer, bitSize uint) {
 	if bitSize%8 != 0 || bitSize == 0 {
 		panic("byteSize must be dividable by 8 and non-zero")
 	}
@@ -0,0 +1,236 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrIncompatibleSchema is returned from CreateMigration if value of old schema cannot be converted to the new one
+var ErrIncompatibleSchema = errors.New("schemas are not compatible")
+
+// Migration
+// Converts serialized values of one schema to serialized values of another one without knowledge of Go types.
+type Migration struct {
+	from, to Schema
+	step     migrationStep
+}
+
+// migrationStep converts value from the beginning of src to dest, dest is zeroed and has size of the new schema
+type migrationStep func(src, dest []byte)
+
+// CreateMigration
+// Prepares conversion between fixed size schemas. Supported changes are:
+//   - struct fields are matched by name, added fields are zeroed and removed fields are dropped
+//   - declared length of strings and slices and length of arrays can be increased
+//   - integers can be widened, unsigned integers can be widened to signed ones, float32 and complex64 can be widened
+//     to float64 and complex128
+//   - struct types can be renamed
+func CreateMigration(from, to Schema) (Migration, error) {
+	step, err := createMigrationStep(from, to, "")
+	if err != nil {
+		return Migration{}, err
+	}
+	return Migration{from: from, to: to, step: step}, nil
+}
+
+// Convert
+// Converts value serialized by the old schema at the beginning of data to value serialized by the new schema.
+func (m Migration) Convert(data []byte) []byte {
+	dest := make([]byte, m.to.Size())
+	m.step(data, dest)
+	return dest
+}
+
+// From
+// Returns the old schema.
+func (m Migration) From() Schema {
+	return m.from
+}
+
+// To
+// Returns the new schema.
+func (m Migration) To() Schema {
+	return m.to
+}
+
+func createMigrationStep(from, to Schema, path string) (migrationStep, error) {
+	incompatible := func(reason string) error {
+		return fmt.Errorf("%w: %s: %s cannot be converted to %s: %s", ErrIncompatibleSchema, pathOrValue(path),
+			from, to, reason)
+	}
+	if hasVariableLength(from) || hasVariableLength(to) {
+		return nil, incompatible("schemas with variable length are not supported")
+	}
+	switch {
+	case from.Kind == to.Kind && from.Kind == KindBool:
+		return copyStep(1), nil
+	case from.Kind == KindInt && to.Kind == KindInt && from.Bits <= to.Bits:
+		return intStep(from.Bits, to.Bits), nil
+	case from.Kind == KindUint && to.Kind == KindUint && from.Bits <= to.Bits,
+		from.Kind == KindUint && to.Kind == KindInt && from.Bits < to.Bits:
+		// zero extension, dest is already zeroed
+		offset := uint(to.Bits-from.Bits) / 8
+		return func(src, dest []byte) {
+			copy(dest[offset:], src[:from.Bits/8])
+		}, nil
+	case from.Kind == KindFloat && to.Kind == KindFloat && from.Bits <= to.Bits:
+		if from.Bits == to.Bits {
+			return copyStep(uint(from.Bits) / 8), nil
+		}
+		return func(src, dest []byte) {
+			fromUint64(math.Float64bits(float64(math.Float32frombits(toUint32(src)))), dest)
+		}, nil
+	case from.Kind == KindComplex && to.Kind == KindComplex && from.Bits <= to.Bits:
+		if from.Bits == to.Bits {
+			return copyStep(uint(from.Bits) / 8), nil
+		}
+		return func(src, dest []byte) {
+			fromUint64(math.Float64bits(float64(math.Float32frombits(toUint32(src)))), dest)
+			fromUint64(math.Float64bits(float64(math.Float32frombits(toUint32(src[4:])))), dest[8:])
+		}, nil
+	case from.Kind == KindString && to.Kind == KindString:
+		if from.Length > to.Length {
+			return nil, incompatible("string cannot be shortened")
+		}
+		return copyStep(from.Size()), nil
+	case from.Kind == KindSlice && to.Kind == KindSlice:
+		if from.Length > to.Length {
+			return nil, incompatible("slice cannot be shortened")
+		}
+		element, err := createMigrationStep(*from.Element, *to.Element, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		fromSize, toSize := from.Element.Size(), to.Element.Size()
+		return func(src, dest []byte) {
+			length := toUint32(src)
+			fromUint32(length, dest)
+			for i := uint(0); i < uint(length); i++ {
+				element(src[4+i*fromSize:], dest[4+i*toSize:])
+			}
+		}, nil
+	case from.Kind == KindArray && to.Kind == KindArray:
+		if from.Length > to.Length {
+			return nil, incompatible("array cannot be shortened")
+		}
+		element, err := createMigrationStep(*from.Element, *to.Element, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		fromSize, toSize := from.Element.Size(), to.Element.Size()
+		return func(src, dest []byte) {
+			for i := uint(0); i < uint(from.Length); i++ {
+				element(src[i*fromSize:], dest[i*toSize:])
+			}
+		}, nil
+	case from.Kind == KindPointer && to.Kind == KindPointer:
+		element, err := createMigrationStep(*from.Element, *to.Element, path)
+		if err != nil {
+			return nil, err
+		}
+		return func(src, dest []byte) {
+			if src[0] == nilPointer {
+				return
+			}
+			dest[0] = src[0]
+			element(src[pointerSize:], dest[pointerSize:])
+		}, nil
+	case from.Kind == KindStruct && to.Kind == KindStruct, from.Kind == KindTuple && to.Kind == KindTuple:
+		return createFieldsStep(from, to, path)
+	default:
+		return nil, incompatible("kinds differ")
+	}
+}
+
+// createFieldsStep
+// Converts fields with the same name, fields missing in the old schema stay zeroed.
+func createFieldsStep(from, to Schema, path string) (migrationStep, error) {
+	type fieldStep struct {
+		fromOffset, toOffset uint
+		step                 migrationStep
+	}
+	fromOffsets := make(map[string]uint, len(from.Fields))
+	fromFields := make(map[string]Schema, len(from.Fields))
+	var offset uint
+	for _, field := range from.Fields {
+		fromOffsets[field.Name], fromFields[field.Name] = offset, field.Schema
+		offset += field.Schema.Size()
+	}
+	var (
+		steps    []fieldStep
+		toOffset uint
+	)
+	for _, field := range to.Fields {
+		if fromField, found := fromFields[field.Name]; found {
+			step, err := createMigrationStep(fromField, field.Schema, joinPath(path, field.Name))
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, fieldStep{fromOffset: fromOffsets[field.Name], toOffset: toOffset, step: step})
+		}
+		toOffset += field.Schema.Size()
+	}
+	return func(src, dest []byte) {
+		for _, field := range steps {
+			field.step(src[field.fromOffset:], dest[field.toOffset:])
+		}
+	}, nil
+}
+
+func copyStep(size uint) migrationStep {
+	return func(src, dest []byte) {
+		copy(dest, src[:size])
+	}
+}
+
+func intStep(fromBits, toBits uint8) migrationStep {
+	return func(src, dest []byte) {
+		var value int64
+		switch fromBits {
+		case 8:
+			value = int64(int8(toUint8(src)))
+		case 16:
+			value = int64(int16(toUint16(src)))
+		case 32:
+			value = int64(int32(toUint32(src)))
+		default:
+			value = int64(toUint64(src))
+		}
+		switch toBits {
+		case 8:
+			fromUint8(uint8(value), dest)
+		case 16:
+			fromUint16(uint16(value), dest)
+		case 32:
+			fromUint32(uint32(value), dest)
+		default:
+			fromUint64(uint64(value), dest)
+		}
+	}
+}
+
+func hasVariableLength(schema Schema) bool {
+	switch schema.Kind {
+	case KindString:
+		return schema.Length == 0
+	case KindSlice:
+		return schema.Length == 0 || hasVariableLength(*schema.Element)
+	case KindArray, KindPointer:
+		return hasVariableLength(*schema.Element)
+	case KindStruct, KindTuple:
+		for _, field := range schema.Fields {
+			if hasVariableLength(field.Schema) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func pathOrValue(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
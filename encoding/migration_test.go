@@ -0,0 +1,103 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigration(t *testing.T) {
+	t.Parallel()
+	type addressV1 struct {
+		Street string `eternal:"size=5"`
+	}
+	type personV1 struct {
+		Name      string `eternal:"size=5"`
+		Age       int8
+		Removed   uint64
+		Height    float32
+		Visits    uint16
+		Tags      []string `eternal:"size=2;elementSize=3"`
+		Addresses [1]addressV1
+		Manager   *addressV1
+	}
+	type addressV2 struct {
+		Number uint8
+		Street string `eternal:"size=10"`
+	}
+	type personV2 struct {
+		Added     bool
+		Age       int32
+		Name      string `eternal:"size=8"`
+		Height    float64
+		Visits    int32
+		Tags      []string `eternal:"size=3;elementSize=3"`
+		Addresses [2]addressV2
+		Manager   *addressV2
+	}
+	v1, err := Create[personV1]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := Create[personV2]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migration, err := CreateMigration(v1.Schema(), v2.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	type Scenario struct {
+		Name     string
+		Value    personV1
+		Expected personV2
+	}
+	scenarios := []Scenario{
+		{
+			Name: "filled",
+			Value: personV1{
+				Name: "Jan", Age: -5, Removed: 7, Height: 1.5, Visits: 65535, Tags: []string{"a", "bcd"},
+				Addresses: [1]addressV1{{Street: "Main"}}, Manager: &addressV1{Street: "Side"},
+			},
+			Expected: personV2{
+				Age: -5, Name: "Jan", Height: 1.5, Visits: 65535, Tags: []string{"a", "bcd"},
+				Addresses: [2]addressV2{{Street: "Main"}}, Manager: &addressV2{Street: "Side"},
+			},
+		},
+		{
+			Name:     "empty",
+			Value:    personV1{},
+			Expected: personV2{},
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			converted := migration.Convert(v1.Serialize(scenario.Value))
+			assert.Equal(t, scenario.Expected, v2.Deserialize(converted))
+		})
+	}
+
+	int8Schema := CreateForPrimitive[int8]().Schema()
+	uint32Schema := CreateForPrimitive[uint32]().Schema()
+	shortString, err := CreateForString[string](2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variable, err := CreateVariable[string]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, incompatible := range []struct{ From, To Schema }{
+		{From: v2.Schema(), To: v1.Schema()},
+		{From: CreateForPrimitive[int16]().Schema(), To: int8Schema},
+		{From: int8Schema, To: uint32Schema},
+		{From: uint32Schema, To: CreateForPrimitive[int32]().Schema()},
+		{From: CreateForPrimitive[float64]().Schema(), To: uint32Schema},
+		{From: variable.Schema(), To: shortString.Schema()},
+	} {
+		_, err := CreateMigration(incompatible.From, incompatible.To)
+		assert.ErrorIs(t, err, ErrIncompatibleSchema, "%s to %s", incompatible.From, incompatible.To)
+	}
+}
@@ -0,0 +1,366 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ErrInvalidKey is returned from KeyCodec.Decode if bytes were not produced by the codec
+var ErrInvalidKey = errors.New("bytes are not valid encoded key")
+
+const (
+	escapeByte     byte = 0x00
+	escapedByte    byte = 0xff // 0x00 in string is encoded as 0x00 0xff
+	terminatorByte byte = 0x01 // string ends with 0x00 0x01
+)
+
+// KeyCodec
+// Order-preserving encoding of keys. For any two values a < b, bytes.Compare(Encode(a), Encode(b)) < 0 holds,
+// so encoded keys can be compared, searched and prefix compressed as plain bytes.
+//   - unsigned integers are stored in big endian
+//   - signed integers are stored in big endian with flipped sign bit
+//   - floats have flipped sign bit if positive, all bits flipped if negative (-0 is ordered before +0, NaNs are
+//     ordered by their bits at both ends)
+//   - strings and []byte have every 0x00 escaped as 0x00 0xff and are terminated by 0x00 0x01
+//   - arrays, structs and Tuple are encoded as concatenation of their elements, so they are ordered lexicographically
+//
+// Unlike Serializer, encoded strings do not have fixed length. int and uint are always encoded to 8 bytes.
+type KeyCodec[T any] struct {
+	blueprint orderedBlueprint
+}
+
+// CreateKeyCodec
+// Fields in structs can be ignored by setting tag "eternal" on property to "ignored". Pointers, slices except []byte,
+// complex numbers, maps and interfaces are not supported.
+func CreateKeyCodec[T any]() (KeyCodec[T], error) {
+	blueprint, err := handleOrderedType(reflect.TypeFor[T]())
+	if err != nil {
+		return KeyCodec[T]{}, err
+	}
+	return KeyCodec[T]{blueprint: blueprint}, nil
+}
+
+// CreateKeyCodecForTuple
+// Composes codecs of tuple parts, tuples are ordered by First and then by Second.
+func CreateKeyCodecForTuple[F, S any](first KeyCodec[F], second KeyCodec[S]) KeyCodec[Tuple[F, S]] {
+	return KeyCodec[Tuple[F, S]]{
+		blueprint: orderedStructBlueprint{
+			fields: []orderedField{
+				{fieldIndex: 0, blueprint: first.blueprint},
+				{fieldIndex: 1, blueprint: second.blueprint},
+			},
+		},
+	}
+}
+
+// Encode
+// Returns order-preserving encoding of value.
+func (k KeyCodec[T]) Encode(value T) []byte {
+	return k.Append(nil, value)
+}
+
+// Append
+// Appends order-preserving encoding of value to dest and returns extended slice.
+func (k KeyCodec[T]) Append(dest []byte, value T) []byte {
+	return k.blueprint.append(dest, reflect.ValueOf(value))
+}
+
+// Decode
+// Decodes value from the beginning of data and returns number of consumed bytes.
+func (k KeyCodec[T]) Decode(data []byte) (T, int, error) {
+	var value T
+	read, err := k.blueprint.decode(data, reflect.ValueOf(&value).Elem())
+	if err != nil {
+		var emptyValue T
+		return emptyValue, 0, err
+	}
+	return value, read, nil
+}
+
+type orderedBlueprint interface {
+	append(dest []byte, value reflect.Value) []byte
+	decode(src []byte, value reflect.Value) (int, error)
+}
+
+func handleOrderedType(_type reflect.Type) (orderedBlueprint, error) {
+	switch _type.Kind() {
+	case reflect.Bool:
+		return orderedBoolBlueprint{}, nil
+	case reflect.Int8:
+		return orderedIntBlueprint{width: 1}, nil
+	case reflect.Int16:
+		return orderedIntBlueprint{width: 2}, nil
+	case reflect.Int32:
+		return orderedIntBlueprint{width: 4}, nil
+	case reflect.Int, reflect.Int64:
+		return orderedIntBlueprint{width: 8}, nil
+	case reflect.Uint8:
+		return orderedUintBlueprint{width: 1}, nil
+	case reflect.Uint16:
+		return orderedUintBlueprint{width: 2}, nil
+	case reflect.Uint32:
+		return orderedUintBlueprint{width: 4}, nil
+	case reflect.Uint, reflect.Uint64:
+		return orderedUintBlueprint{width: 8}, nil
+	case reflect.Float32:
+		return orderedFloatBlueprint{width: 4}, nil
+	case reflect.Float64:
+		return orderedFloatBlueprint{width: 8}, nil
+	case reflect.String:
+		return orderedBytesBlueprint{}, nil
+	case reflect.Slice:
+		if _type.Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("type %s: only byte slices can be keys: %w", _type, ErrUnsupportedType)
+		}
+		return orderedBytesBlueprint{}, nil
+	case reflect.Array:
+		element, err := handleOrderedType(_type.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return orderedArrayBlueprint{element: element, length: _type.Len()}, nil
+	case reflect.Struct:
+		blueprint := orderedStructBlueprint{fields: make([]orderedField, 0, _type.NumField())}
+		for i := 0; i < _type.NumField(); i++ {
+			field := _type.Field(i)
+			config, err := parseConfig(field.Tag.Get(tagName))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse config for property %s of type %s: %w", field.Name, _type,
+					err)
+			}
+			if config.ignore {
+				continue
+			}
+			fieldBlueprint, err := handleOrderedType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("could not handle property %s of type %s: %w", field.Name, _type, err)
+			}
+			blueprint.fields = append(blueprint.fields, orderedField{fieldIndex: i, blueprint: fieldBlueprint})
+		}
+		return blueprint, nil
+	default:
+		return nil, fmt.Errorf("type %s: %w", _type.String(), ErrUnsupportedType)
+	}
+}
+
+func appendUint(dest []byte, value uint64, width int) []byte {
+	for shift := (width - 1) * 8; shift >= 0; shift -= 8 {
+		dest = append(dest, byte(value>>shift))
+	}
+	return dest
+}
+
+func readUint(src []byte, width int) (uint64, error) {
+	if len(src) < width {
+		return 0, fmt.Errorf("%w: expected %d bytes, %d bytes left", ErrInvalidKey, width, len(src))
+	}
+	var value uint64
+	for _, b := range src[:width] {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+type orderedBoolBlueprint struct{}
+
+func (o orderedBoolBlueprint) append(dest []byte, value reflect.Value) []byte {
+	if value.Bool() {
+		return append(dest, 1)
+	}
+	return append(dest, 0)
+}
+
+func (o orderedBoolBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	raw, err := readUint(src, 1)
+	if err != nil {
+		return 0, err
+	}
+	value.SetBool(raw != 0)
+	return 1, nil
+}
+
+type orderedUintBlueprint struct {
+	width int
+}
+
+func (o orderedUintBlueprint) append(dest []byte, value reflect.Value) []byte {
+	return appendUint(dest, value.Uint(), o.width)
+}
+
+func (o orderedUintBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	raw, err := readUint(src, o.width)
+	if err != nil {
+		return 0, err
+	}
+	value.SetUint(raw)
+	return o.width, nil
+}
+
+type orderedIntBlueprint struct {
+	width int
+}
+
+func (o orderedIntBlueprint) signBit() uint64 {
+	return 1 << (o.width*8 - 1)
+}
+
+func (o orderedIntBlueprint) append(dest []byte, value reflect.Value) []byte {
+	// negative numbers have sign bit set, flipping it moves them before positive ones
+	return appendUint(dest, uint64(value.Int())^o.signBit(), o.width)
+}
+
+func (o orderedIntBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	raw, err := readUint(src, o.width)
+	if err != nil {
+		return 0, err
+	}
+	raw ^= o.signBit()
+	// extend sign to the whole int64
+	shift := 64 - o.width*8
+	value.SetInt(int64(raw<<shift) >> shift)
+	return o.width, nil
+}
+
+type orderedFloatBlueprint struct {
+	width int
+}
+
+func (o orderedFloatBlueprint) append(dest []byte, value reflect.Value) []byte {
+	var raw, signBit uint64
+	if o.width == 4 {
+		raw, signBit = uint64(math.Float32bits(float32(value.Float()))), 1<<31
+	} else {
+		raw, signBit = math.Float64bits(value.Float()), 1<<63
+	}
+	if raw&signBit != 0 {
+		// greater magnitude of negative number means lesser number
+		raw ^= signBit | (signBit - 1)
+	} else {
+		raw |= signBit
+	}
+	return appendUint(dest, raw, o.width)
+}
+
+func (o orderedFloatBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	raw, err := readUint(src, o.width)
+	if err != nil {
+		return 0, err
+	}
+	signBit := uint64(1) << (o.width*8 - 1)
+	if raw&signBit != 0 {
+		raw &^= signBit
+	} else {
+		raw ^= signBit | (signBit - 1)
+	}
+	if o.width == 4 {
+		value.SetFloat(float64(math.Float32frombits(uint32(raw))))
+	} else {
+		value.SetFloat(math.Float64frombits(raw))
+	}
+	return o.width, nil
+}
+
+// orderedBytesBlueprint
+// Handles both strings and byte slices.
+type orderedBytesBlueprint struct{}
+
+func (o orderedBytesBlueprint) append(dest []byte, value reflect.Value) []byte {
+	var data []byte
+	if value.Kind() == reflect.String {
+		data = []byte(value.String())
+	} else {
+		data = value.Bytes()
+	}
+	for {
+		position := bytes.IndexByte(data, escapeByte)
+		if position == -1 {
+			break
+		}
+		dest = append(append(dest, data[:position]...), escapeByte, escapedByte)
+		data = data[position+1:]
+	}
+	return append(append(dest, data...), escapeByte, terminatorByte)
+}
+
+func (o orderedBytesBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	var (
+		data = make([]byte, 0)
+		read int
+	)
+	for {
+		position := bytes.IndexByte(src[read:], escapeByte)
+		if position == -1 || read+position+1 >= len(src) {
+			return 0, fmt.Errorf("%w: string is not terminated", ErrInvalidKey)
+		}
+		data = append(data, src[read:read+position]...)
+		read += position + 2
+		switch src[read-1] {
+		case escapedByte:
+			data = append(data, escapeByte)
+		case terminatorByte:
+			if value.Kind() == reflect.String {
+				value.SetString(string(data))
+			} else {
+				value.SetBytes(data)
+			}
+			return read, nil
+		default:
+			return 0, fmt.Errorf("%w: invalid escape sequence", ErrInvalidKey)
+		}
+	}
+}
+
+type orderedArrayBlueprint struct {
+	length  int
+	element orderedBlueprint
+}
+
+func (o orderedArrayBlueprint) append(dest []byte, value reflect.Value) []byte {
+	for i := 0; i < o.length; i++ {
+		dest = o.element.append(dest, value.Index(i))
+	}
+	return dest
+}
+
+func (o orderedArrayBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	var read int
+	for i := 0; i < o.length; i++ {
+		elementRead, err := o.element.decode(src[read:], value.Index(i))
+		if err != nil {
+			return 0, err
+		}
+		read += elementRead
+	}
+	return read, nil
+}
+
+type orderedField struct {
+	fieldIndex int
+	blueprint  orderedBlueprint
+}
+
+type orderedStructBlueprint struct {
+	fields []orderedField
+}
+
+func (o orderedStructBlueprint) append(dest []byte, value reflect.Value) []byte {
+	for _, field := range o.fields {
+		dest = field.blueprint.append(dest, value.Field(field.fieldIndex))
+	}
+	return dest
+}
+
+func (o orderedStructBlueprint) decode(src []byte, value reflect.Value) (int, error) {
+	var read int
+	for _, field := range o.fields {
+		fieldRead, err := field.blueprint.decode(src[read:], value.Field(field.fieldIndex))
+		if err != nil {
+			return 0, err
+		}
+		read += fieldRead
+	}
+	return read, nil
+}
@@ -0,0 +1,109 @@
+package encoding
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkOrder
+// Checks that values sorted by compare are encoded to ascending bytes and can be decoded back.
+func checkOrder[T any](t *testing.T, values []T, compare func(a, b T) int) {
+	t.Helper()
+	codec, err := CreateKeyCodec[T]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = slices.Clone(values)
+	slices.SortFunc(values, compare)
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		encoded[i] = codec.Encode(value)
+		decoded, read, err := codec.Decode(append(slices.Clone(encoded[i]), 0xaa))
+		assert.NoError(t, err)
+		assert.Equal(t, len(encoded[i]), read)
+		assert.Equal(t, value, decoded)
+	}
+	for i := 1; i < len(values); i++ {
+		assert.Equal(t, compare(values[i-1], values[i]), bytes.Compare(encoded[i-1], encoded[i]),
+			"values %v and %v", values[i-1], values[i])
+	}
+}
+
+func TestKeyCodec(t *testing.T) {
+	t.Parallel()
+	t.Run("int", func(t *testing.T) {
+		checkOrder(t, []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}, cmp.Compare)
+		checkOrder(t, []int8{math.MinInt8, -1, 0, 1, math.MaxInt8}, cmp.Compare)
+		checkOrder(t, []int{math.MinInt, -5, 0, 5, math.MaxInt}, cmp.Compare)
+	})
+	t.Run("uint", func(t *testing.T) {
+		checkOrder(t, []uint16{0, 1, 255, 256, math.MaxUint16}, cmp.Compare)
+		checkOrder(t, []uint{0, 1, math.MaxUint}, cmp.Compare)
+	})
+	t.Run("float", func(t *testing.T) {
+		checkOrder(t, []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64, 0,
+			math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1)}, cmp.Compare)
+		checkOrder(t, []float32{float32(math.Inf(-1)), -2.5, -1, 0, 0.25, 3, float32(math.Inf(1))}, cmp.Compare)
+	})
+	t.Run("string", func(t *testing.T) {
+		checkOrder(t, []string{"", "\x00", "\x00\x00", "\x00\x01", "\x00a", "a", "a\x00", "a\x00b", "a\x01", "ab",
+			"b", "\xff", "\xff\x00"}, cmp.Compare)
+		checkOrder(t, [][]byte{{}, {0}, {0, 0xff}, {1}, {0xff, 0xff}}, bytes.Compare)
+	})
+	t.Run("tuple", func(t *testing.T) {
+		compare := func(a, b Tuple[string, int32]) int {
+			return cmp.Or(cmp.Compare(a.First, b.First), cmp.Compare(a.Second, b.Second))
+		}
+		checkOrder(t, []Tuple[string, int32]{{"", 5}, {"a", -1}, {"a", 0}, {"a", 7}, {"a\x00", -100}, {"ab", -5},
+			{"b", math.MinInt32}}, compare)
+	})
+	t.Run("struct", func(t *testing.T) {
+		type key struct {
+			Tenant  [2]uint8
+			Name    string
+			Ignored int `eternal:"ignored"`
+			Version int16
+		}
+		compare := func(a, b key) int {
+			return cmp.Or(slices.Compare(a.Tenant[:], b.Tenant[:]), cmp.Compare(a.Name, b.Name),
+				cmp.Compare(a.Version, b.Version))
+		}
+		checkOrder(t, []key{{[2]uint8{0, 1}, "z", 0, 1}, {[2]uint8{1, 0}, "", 0, -1}, {[2]uint8{1, 0}, "", 0, 3},
+			{[2]uint8{1, 0}, "a", 0, -3}}, compare)
+	})
+	t.Run("composed tuple", func(t *testing.T) {
+		stringCodec, err := CreateKeyCodec[string]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		floatCodec, err := CreateKeyCodec[float64]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		codec := CreateKeyCodecForTuple(stringCodec, floatCodec)
+		assert.Negative(t, bytes.Compare(codec.Encode(Tuple[string, float64]{"a", 2}),
+			codec.Encode(Tuple[string, float64]{"a", 10})))
+		decoded, _, err := codec.Decode(codec.Encode(Tuple[string, float64]{"x\x00y", -0.5}))
+		assert.NoError(t, err)
+		assert.Equal(t, Tuple[string, float64]{"x\x00y", -0.5}, decoded)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		codec, err := CreateKeyCodec[Tuple[string, uint32]]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range [][]byte{{}, {'a'}, {'a', 0}, {'a', 0, 7}, {0, 1, 0, 0}} {
+			_, _, err := codec.Decode(data)
+			assert.ErrorIs(t, err, ErrInvalidKey, "data %v", data)
+		}
+		_, err = CreateKeyCodec[*int]()
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+		_, err = CreateKeyCodec[[]int]()
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+	})
+}
@@ -0,0 +1,468 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSchema is returned when textual description of schema cannot be parsed
+var ErrInvalidSchema = errors.New("schema description is not valid")
+
+// Kind
+// Kind of value described by Schema.
+type Kind uint8
+
+const (
+	KindBool Kind = iota + 1
+	KindInt
+	KindUint
+	KindFloat
+	KindComplex
+	KindString
+	KindSlice
+	KindArray
+	KindPointer
+	KindStruct
+	KindTuple
+)
+
+var kindNames = map[Kind]string{
+	KindBool:    "bool",
+	KindInt:     "int",
+	KindUint:    "uint",
+	KindFloat:   "float",
+	KindComplex: "complex",
+	KindString:  "string",
+	KindSlice:   "slice",
+	KindArray:   "array",
+	KindPointer: "pointer",
+	KindStruct:  "struct",
+	KindTuple:   "tuple",
+}
+
+func (k Kind) String() string {
+	if name, found := kindNames[k]; found {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Schema
+// Describes layout of serialized value, so data can be read without the Go type they were created from.
+// Unlike Signature, schema contains names of struct fields.
+type Schema struct {
+	Kind Kind
+	// Bits is size of numbers in bits
+	Bits uint8
+	// Length is declared length of strings (in bytes) and slices or length of arrays. Zero means variable length.
+	Length uint32
+	// Element describes elements of slices and arrays and value of pointers
+	Element *Schema
+	// Name is name of struct type including its package path, empty for anonymous structs
+	Name string
+	// Fields of struct in serialization order, tuple has fields First and Second
+	Fields []SchemaField
+}
+
+type SchemaField struct {
+	Name   string
+	Schema Schema
+}
+
+// Size
+// Returns size of serialized value in bytes. Schemas with variable length have size of the shortest possible value.
+func (s Schema) Size() uint {
+	switch s.Kind {
+	case KindBool:
+		return 1
+	case KindInt, KindUint, KindFloat, KindComplex:
+		return uint(s.Bits) / 8
+	case KindString:
+		return uint(s.Length) + 4 // 4 bytes for uint32
+	case KindSlice:
+		return uint(s.Length)*s.Element.Size() + 4 // 4 bytes for uint32
+	case KindArray:
+		return uint(s.Length) * s.Element.Size()
+	case KindPointer:
+		return pointerSize + s.Element.Size()
+	case KindStruct, KindTuple:
+		var size uint
+		for _, field := range s.Fields {
+			size += field.Schema.Size()
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// String
+// Returns textual description of schema, e.g. struct("example.com/pkg.Person",{Name:string(10),Age:uint(8)}).
+func (s Schema) String() string {
+	builder := &strings.Builder{}
+	s.write(builder)
+	return builder.String()
+}
+
+func (s Schema) write(builder *strings.Builder) {
+	builder.WriteString(s.Kind.String())
+	switch s.Kind {
+	case KindInt, KindUint, KindFloat, KindComplex:
+		builder.WriteString(fmt.Sprintf("(%d)", s.Bits))
+	case KindString:
+		builder.WriteString("(" + lengthString(s.Length) + ")")
+	case KindSlice, KindArray:
+		builder.WriteString("(" + lengthString(s.Length) + ",")
+		s.Element.write(builder)
+		builder.WriteString(")")
+	case KindPointer:
+		builder.WriteString("(")
+		s.Element.write(builder)
+		builder.WriteString(")")
+	case KindStruct:
+		builder.WriteString("(" + strconv.Quote(s.Name) + ",{")
+		for i, field := range s.Fields {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(field.Name + ":")
+			field.Schema.write(builder)
+		}
+		builder.WriteString("})")
+	case KindTuple:
+		builder.WriteString("(")
+		s.Fields[0].Schema.write(builder)
+		builder.WriteString(",")
+		s.Fields[1].Schema.write(builder)
+		builder.WriteString(")")
+	}
+}
+
+const variableLength = "variable"
+
+func lengthString(length uint32) string {
+	if length == 0 {
+		return variableLength
+	}
+	return strconv.FormatUint(uint64(length), 10)
+}
+
+// Schema
+// Returns schema of serialized values.
+func (s Serializer[T]) Schema() Schema {
+	return schemaOf(s.blueprint)
+}
+
+// Schema
+// Returns schema of serialized values, strings and slices have variable length.
+func (v VariableSerializer[T]) Schema() Schema {
+	return variableSchemaOf(v.blueprint)
+}
+
+// TupleSchema
+// Returns schema of Tuple composed of given schemas.
+func TupleSchema(first, second Schema) Schema {
+	return Schema{
+		Kind:   KindTuple,
+		Fields: []SchemaField{{Name: "First", Schema: first}, {Name: "Second", Schema: second}},
+	}
+}
+
+func schemaOf(blueprint blueprint) Schema {
+	switch blueprint := blueprint.(type) {
+	case boolBlueprint:
+		return Schema{Kind: KindBool}
+	case int8Blueprint:
+		return Schema{Kind: KindInt, Bits: 8}
+	case int16Blueprint:
+		return Schema{Kind: KindInt, Bits: 16}
+	case int32Blueprint:
+		return Schema{Kind: KindInt, Bits: 32}
+	case int64Blueprint:
+		return Schema{Kind: KindInt, Bits: 64}
+	case uint8Blueprint:
+		return Schema{Kind: KindUint, Bits: 8}
+	case uint16Blueprint:
+		return Schema{Kind: KindUint, Bits: 16}
+	case uint32Blueprint:
+		return Schema{Kind: KindUint, Bits: 32}
+	case uint64Blueprint:
+		return Schema{Kind: KindUint, Bits: 64}
+	case float32Blueprint:
+		return Schema{Kind: KindFloat, Bits: 32}
+	case float64Blueprint:
+		return Schema{Kind: KindFloat, Bits: 64}
+	case complex64Blueprint:
+		return Schema{Kind: KindComplex, Bits: 64}
+	case complex128Blueprint:
+		return Schema{Kind: KindComplex, Bits: 128}
+	case stringBlueprint:
+		return Schema{Kind: KindString, Length: blueprint.length}
+	case sliceBlueprint:
+		element := schemaOf(blueprint.element)
+		return Schema{Kind: KindSlice, Length: blueprint.length, Element: &element}
+	case arrayBlueprint:
+		element := schemaOf(blueprint.element)
+		return Schema{Kind: KindArray, Length: uint32(blueprint.length), Element: &element}
+	case pointerBlueprint:
+		element := schemaOf(blueprint.element)
+		return Schema{Kind: KindPointer, Element: &element}
+	case structBlueprint:
+		schema := Schema{Kind: KindStruct, Name: structName(blueprint.structType.PkgPath(), blueprint.structType.Name())}
+		for _, field := range blueprint.fields {
+			schema.Fields = append(schema.Fields, SchemaField{
+				Name:   blueprint.structType.Field(field.fieldIndex).Name,
+				Schema: schemaOf(field.blueprint),
+			})
+		}
+		return schema
+	case tupleBlueprint:
+		return TupleSchema(schemaOf(blueprint.first), schemaOf(blueprint.second))
+	default:
+		panic(fmt.Sprintf("unknown blueprint %T", blueprint))
+	}
+}
+
+func variableSchemaOf(blueprint variableBlueprint) Schema {
+	switch blueprint := blueprint.(type) {
+	case variableFixedBlueprint:
+		return schemaOf(blueprint.fixed)
+	case variableStringBlueprint:
+		return Schema{Kind: KindString}
+	case variableSliceBlueprint:
+		element := variableSchemaOf(blueprint.element)
+		return Schema{Kind: KindSlice, Element: &element}
+	case variableArrayBlueprint:
+		element := variableSchemaOf(blueprint.element)
+		return Schema{Kind: KindArray, Length: uint32(blueprint.length), Element: &element}
+	case variablePointerBlueprint:
+		element := variableSchemaOf(blueprint.element)
+		return Schema{Kind: KindPointer, Element: &element}
+	case variableStructBlueprint:
+		schema := Schema{Kind: KindStruct, Name: structName(blueprint.structType.PkgPath(), blueprint.structType.Name())}
+		for _, field := range blueprint.fields {
+			schema.Fields = append(schema.Fields, SchemaField{
+				Name:   blueprint.structType.Field(field.fieldIndex).Name,
+				Schema: variableSchemaOf(field.variableBlueprint),
+			})
+		}
+		return schema
+	default:
+		panic(fmt.Sprintf("unknown blueprint %T", blueprint))
+	}
+}
+
+func structName(pkgPath, name string) string {
+	if pkgPath == "" {
+		return name
+	}
+	return pkgPath + "." + name
+}
+
+// ParseSchema
+// Parses schema from description returned by Schema.String.
+func ParseSchema(description string) (Schema, error) {
+	parser := &schemaParser{input: description}
+	schema, err := parser.parse()
+	if err != nil {
+		return Schema{}, err
+	}
+	if parser.position != len(parser.input) {
+		return Schema{}, parser.errorf("unexpected trailing characters")
+	}
+	return schema, nil
+}
+
+type schemaParser struct {
+	input    string
+	position int
+}
+
+func (p *schemaParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: position %d: %s", ErrInvalidSchema, p.position, fmt.Sprintf(format, args...))
+}
+
+// word reads identifier consisting of letters, digits and underscores
+func (p *schemaParser) word() string {
+	start := p.position
+	for p.position < len(p.input) {
+		c := p.input[p.position]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c < 0x80 {
+			break
+		}
+		p.position++
+	}
+	return p.input[start:p.position]
+}
+
+func (p *schemaParser) expect(c byte) error {
+	if p.position >= len(p.input) || p.input[p.position] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.position++
+	return nil
+}
+
+func (p *schemaParser) number(bitSize int) (uint64, error) {
+	word := p.word()
+	value, err := strconv.ParseUint(word, 10, bitSize)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", word)
+	}
+	return value, nil
+}
+
+func (p *schemaParser) length() (uint32, error) {
+	if strings.HasPrefix(p.input[p.position:], variableLength) {
+		p.position += len(variableLength)
+		return 0, nil
+	}
+	length, err := p.number(32)
+	if err != nil {
+		return 0, err
+	}
+	if length == 0 {
+		return 0, p.errorf("length must be positive or %s", variableLength)
+	}
+	return uint32(length), nil
+}
+
+func (p *schemaParser) parse() (Schema, error) {
+	name := p.word()
+	var kind Kind
+	for candidate, candidateName := range kindNames {
+		if candidateName == name {
+			kind = candidate
+		}
+	}
+	if kind == 0 {
+		return Schema{}, p.errorf("unknown kind %q", name)
+	}
+	schema := Schema{Kind: kind}
+	if kind == KindBool {
+		return schema, nil
+	}
+	if err := p.expect('('); err != nil {
+		return Schema{}, err
+	}
+	var err error
+	switch kind {
+	case KindInt, KindUint, KindFloat, KindComplex:
+		var bits uint64
+		if bits, err = p.number(8); err != nil {
+			return Schema{}, err
+		}
+		schema.Bits = uint8(bits)
+		if !validBits(kind, schema.Bits) {
+			return Schema{}, p.errorf("%s cannot have %d bits", kind, bits)
+		}
+	case KindString:
+		schema.Length, err = p.length()
+	case KindSlice, KindArray:
+		if schema.Length, err = p.length(); err != nil {
+			return Schema{}, err
+		}
+		if err = p.expect(','); err != nil {
+			return Schema{}, err
+		}
+		schema.Element, err = p.element()
+	case KindPointer:
+		schema.Element, err = p.element()
+	case KindStruct:
+		schema.Name, schema.Fields, err = p.structBody()
+	case KindTuple:
+		var first, second Schema
+		if first, err = p.parse(); err != nil {
+			return Schema{}, err
+		}
+		if err = p.expect(','); err != nil {
+			return Schema{}, err
+		}
+		if second, err = p.parse(); err != nil {
+			return Schema{}, err
+		}
+		schema = TupleSchema(first, second)
+	}
+	if err != nil {
+		return Schema{}, err
+	}
+	return schema, p.expect(')')
+}
+
+func (p *schemaParser) element() (*Schema, error) {
+	element, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &element, nil
+}
+
+func (p *schemaParser) structBody() (string, []SchemaField, error) {
+	name, err := p.quoted()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := p.expect(','); err != nil {
+		return "", nil, err
+	}
+	if err := p.expect('{'); err != nil {
+		return "", nil, err
+	}
+	var fields []SchemaField
+	for p.position < len(p.input) && p.input[p.position] != '}' {
+		if len(fields) > 0 {
+			if err := p.expect(','); err != nil {
+				return "", nil, err
+			}
+		}
+		fieldName := p.word()
+		if fieldName == "" {
+			return "", nil, p.errorf("expected field name")
+		}
+		if err := p.expect(':'); err != nil {
+			return "", nil, err
+		}
+		schema, err := p.parse()
+		if err != nil {
+			return "", nil, err
+		}
+		fields = append(fields, SchemaField{Name: fieldName, Schema: schema})
+	}
+	return name, fields, p.expect('}')
+}
+
+func (p *schemaParser) quoted() (string, error) {
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	start := p.position - 1
+	for p.position < len(p.input) {
+		switch p.input[p.position] {
+		case '\\':
+			p.position += 2
+			continue
+		case '"':
+			p.position++
+			value, err := strconv.Unquote(p.input[start:p.position])
+			if err != nil {
+				return "", p.errorf("invalid quoted string")
+			}
+			return value, nil
+		}
+		p.position++
+	}
+	return "", p.errorf("quoted string is not terminated")
+}
+
+func validBits(kind Kind, bits uint8) bool {
+	switch kind {
+	case KindInt, KindUint:
+		return bits == 8 || bits == 16 || bits == 32 || bits == 64
+	case KindFloat:
+		return bits == 32 || bits == 64
+	default: // KindComplex
+		return bits == 64 || bits == 128
+	}
+}
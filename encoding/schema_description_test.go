@@ -0,0 +1,85 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+	type inner struct {
+		Values []int16 `eternal:"size=3"`
+	}
+	type described struct {
+		Active  bool
+		Name    *string `eternal:"size=10"`
+		Scores  [2]float32
+		Inner   inner
+		Ignored string `eternal:"ignored"`
+		Complex complex128
+	}
+	serializer, err := Create[described]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	variableSerializer, err := CreateVariable[described]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type Scenario struct {
+		Name                string
+		Schema              Schema
+		ExpectedDescription string
+		ExpectedSize        uint
+	}
+	scenarios := []Scenario{
+		{
+			Name:   "struct",
+			Schema: serializer.Schema(),
+			ExpectedDescription: `struct("github.com/zelezo001/eternal/encoding.described",{Active:bool,` +
+				`Name:pointer(string(10)),Scores:array(2,float(32)),` +
+				`Inner:struct("github.com/zelezo001/eternal/encoding.inner",{Values:slice(3,int(16))}),` +
+				`Complex:complex(128)})`,
+			ExpectedSize: serializer.Size(),
+		},
+		{
+			Name:   "variable",
+			Schema: variableSerializer.Schema(),
+			ExpectedDescription: `struct("github.com/zelezo001/eternal/encoding.described",{Active:bool,` +
+				`Name:pointer(string(variable)),Scores:array(2,float(32)),` +
+				`Inner:struct("github.com/zelezo001/eternal/encoding.inner",{Values:slice(variable,int(16))}),` +
+				`Complex:complex(128)})`,
+			ExpectedSize: 1 + 5 + 8 + 4 + 16,
+		},
+		{
+			Name:                "tuple",
+			Schema:              CreateForTuple(CreateForPrimitive[uint32](), CreateForPrimitive[int8]()).Schema(),
+			ExpectedDescription: "tuple(uint(32),int(8))",
+			ExpectedSize:        5,
+		},
+		{
+			Name:                "anonymous struct",
+			Schema:              TupleSchema(Schema{Kind: KindStruct}, Schema{Kind: KindBool}),
+			ExpectedDescription: `tuple(struct("",{}),bool)`,
+			ExpectedSize:        1,
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, scenario.ExpectedDescription, scenario.Schema.String())
+			assert.Equal(t, scenario.ExpectedSize, scenario.Schema.Size())
+			parsed, err := ParseSchema(scenario.ExpectedDescription)
+			assert.NoError(t, err)
+			assert.Equal(t, scenario.ExpectedDescription, parsed.String())
+		})
+	}
+
+	for _, invalid := range []string{"", "bool)", "int(12)", "string(0)", "slice(2)", `struct(name,{})`,
+		`struct("",{A:bool`, "map(string)"} {
+		_, err := ParseSchema(invalid)
+		assert.ErrorIs(t, err, ErrInvalidSchema, invalid)
+	}
+}
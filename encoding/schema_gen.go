@@ -21,7 +21,7 @@ func fromUint16(value uint16, dest []byte) {
 
 func toUint16(src []byte) uint16 {
 	_ = src[1]
-	return uint16(src[0]) << 8 | uint16(src[1])
+	return uint16(src[0])<<8 | uint16(src[1])
 }
 
 func fromUint32(value uint32, dest []byte) {
@@ -33,7 +33,7 @@ func fromUint32(value uint32, dest []byte) {
 
 func toUint32(src []byte) uint32 {
 	_ = src[3]
-	return uint32(src[0]) << 24 | uint32(src[1]) << 16 | uint32(src[2]) << 8 | uint32(src[3])
+	return uint32(src[0])<<24 | uint32(src[1])<<16 | uint32(src[2])<<8 | uint32(src[3])
 }
 
 func fromUint64(value uint64, dest []byte) {
@@ -49,10 +49,9 @@ func fromUint64(value uint64, dest []byte) {
 
 func toUint64(src []byte) uint64 {
 	_ = src[7]
-	return uint64(src[0]) << 56 | uint64(src[1]) << 48 | uint64(src[2]) << 40 | uint64(src[3]) << 32 | uint64(src[4]) << 24 | uint64(src[5]) << 16 | uint64(src[6]) << 8 | uint64(src[7])
+	return uint64(src[0])<<56 | uint64(src[1])<<48 | uint64(src[2])<<40 | uint64(src[3])<<32 | uint64(src[4])<<24 | uint64(src[5])<<16 | uint64(src[6])<<8 | uint64(src[7])
 }
 
-
 type uint8Blueprint struct{}
 
 func (i uint8Blueprint) from(bytes []byte, value reflect.Value) {
@@ -74,7 +73,6 @@ func (b uint8Blueprint) describe(builder io.StringWriter) error {
 
 type int8Blueprint struct{}
 
-
 func (i int8Blueprint) from(bytes []byte, value reflect.Value) {
 	value.SetInt(int64(int8(toUint8(bytes))))
 }
@@ -113,7 +111,6 @@ func (b uint16Blueprint) describe(builder io.StringWriter) error {
 
 type int16Blueprint struct{}
 
-
 func (i int16Blueprint) from(bytes []byte, value reflect.Value) {
 	value.SetInt(int64(int16(toUint16(bytes))))
 }
@@ -152,7 +149,6 @@ func (b uint32Blueprint) describe(builder io.StringWriter) error {
 
 type int32Blueprint struct{}
 
-
 func (i int32Blueprint) from(bytes []byte, value reflect.Value) {
 	value.SetInt(int64(int32(toUint32(bytes))))
 }
@@ -191,7 +187,6 @@ func (b uint64Blueprint) describe(builder io.StringWriter) error {
 
 type int64Blueprint struct{}
 
-
 func (i int64Blueprint) from(bytes []byte, value reflect.Value) {
 	value.SetInt(int64(int64(toUint64(bytes))))
 }
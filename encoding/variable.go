@@ -0,0 +1,362 @@
+package encoding
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ErrTruncatedData is returned from VariableSerializer.Deserialize if data end before the whole value is read
+var ErrTruncatedData = errors.New("data are truncated")
+
+// VariableSerializer
+// Serializes values to bytes of variable length, so strings and slices don't have to be bound.
+// Strings and slices are prefixed by their length encoded as uvarint, size tags are ignored.
+// Other types are encoded the same way as by Serializer.
+type VariableSerializer[T any] struct {
+	blueprint variableBlueprint
+}
+
+// CreateVariable
+// Fields in structs can be ignored by setting tag "eternal" on property to "ignored".
+func CreateVariable[T any]() (VariableSerializer[T], error) {
+	blueprint, err := handleVariableType(newContext(), reflect.TypeFor[T]())
+	if err != nil {
+		return VariableSerializer[T]{}, err
+	}
+	return VariableSerializer[T]{blueprint: blueprint}, nil
+}
+
+func (v VariableSerializer[T]) Serialize(value T) []byte {
+	return v.blueprint.append(nil, reflect.ValueOf(value))
+}
+
+func (v VariableSerializer[T]) Deserialize(data []byte) (T, error) {
+	var value T
+	if _, err := v.blueprint.read(data, reflect.ValueOf(&value).Elem()); err != nil {
+		var emptyValue T
+		return emptyValue, err
+	}
+	return value, nil
+}
+
+func (v VariableSerializer[T]) Signature() [64]byte {
+	var builder = &bytes.Buffer{}
+	err := v.blueprint.describe(builder)
+	if err != nil {
+		// bytes.Buffer does not produce err on writes
+		panic(err)
+	}
+
+	return sha512.Sum512(builder.Bytes())
+}
+
+type variableBlueprint interface {
+	// append serialized value to dest
+	append(dest []byte, value reflect.Value) []byte
+	// read value from the beginning of src and return number of read bytes
+	read(src []byte, value reflect.Value) (int, error)
+	// must uniquely describe given blueprint
+	describe(io.StringWriter) error
+}
+
+func handleVariableType(ctx context, _type reflect.Type) (variableBlueprint, error) {
+	switch _type.Kind() {
+	case reflect.String:
+		return variableStringBlueprint{}, nil
+	case reflect.Slice:
+		element, err := handleVariableType(ctx, _type.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return variableSliceBlueprint{element: element}, nil
+	case reflect.Array:
+		element, err := handleVariableType(ctx, _type.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return variableArrayBlueprint{element: element, length: _type.Len()}, nil
+	case reflect.Pointer:
+		element, err := handleVariableType(ctx, _type.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return variablePointerBlueprint{element: element}, nil
+	case reflect.Struct:
+		if _, ok := ctx.seenStructTypes[_type]; ok {
+			return nil, fmt.Errorf("could not handle type %s: %w", _type, ErrRecursiveStructDefinition)
+		}
+		ctx.seenStructTypes[_type] = struct{}{}
+		defer delete(ctx.seenStructTypes, _type)
+		blueprint := variableStructBlueprint{structType: _type, fields: make([]variableField, 0, _type.NumField())}
+		for i := 0; i < _type.NumField(); i++ {
+			field := _type.Field(i)
+			config, err := parseConfig(field.Tag.Get(tagName))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse config for property %s of type %s: %w", field.Name, _type,
+					err)
+			}
+			if config.ignore {
+				continue
+			}
+			fieldBlueprint, err := handleVariableType(ctx, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("could not handle property %s of type %s: %w", field.Name, _type, err)
+			}
+			blueprint.fields = append(blueprint.fields, variableField{fieldIndex: i, variableBlueprint: fieldBlueprint})
+		}
+		return blueprint, nil
+	default:
+		// remaining supported types have fixed size
+		fixed, err := handleType(ctx, _type, config{})
+		if err != nil {
+			return nil, err
+		}
+		return variableFixedBlueprint{fixed: fixed}, nil
+	}
+}
+
+// variableFixedBlueprint
+// Adapts blueprint of fixed size type.
+type variableFixedBlueprint struct {
+	fixed blueprint
+}
+
+func (v variableFixedBlueprint) append(dest []byte, value reflect.Value) []byte {
+	offset := len(dest)
+	dest = append(dest, make([]byte, v.fixed.size())...)
+	v.fixed.to(value, dest[offset:])
+	return dest
+}
+
+func (v variableFixedBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	size := int(v.fixed.size())
+	if len(src) < size {
+		return 0, ErrTruncatedData
+	}
+	v.fixed.from(src, value)
+	return size, nil
+}
+
+func (v variableFixedBlueprint) describe(builder io.StringWriter) error {
+	return v.fixed.describe(builder)
+}
+
+func readLength(src []byte) (int, int, error) {
+	length, read := binary.Uvarint(src)
+	if read <= 0 {
+		return 0, 0, ErrTruncatedData
+	}
+	if length > uint64(len(src)) {
+		// every element takes at least one byte, length cannot be greater than remaining data
+		return 0, 0, ErrTruncatedData
+	}
+	return int(length), read, nil
+}
+
+type variableStringBlueprint struct{}
+
+func (v variableStringBlueprint) append(dest []byte, value reflect.Value) []byte {
+	dest = binary.AppendUvarint(dest, uint64(value.Len()))
+	return append(dest, value.String()...)
+}
+
+func (v variableStringBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	length, read, err := readLength(src)
+	if err != nil {
+		return 0, err
+	}
+	if len(src)-read < length {
+		return 0, ErrTruncatedData
+	}
+	value.SetString(string(src[read : read+length]))
+	return read + length, nil
+}
+
+func (v variableStringBlueprint) describe(builder io.StringWriter) error {
+	_, err := builder.WriteString("string(variable)")
+	return err
+}
+
+type variableSliceBlueprint struct {
+	element variableBlueprint
+}
+
+func (v variableSliceBlueprint) append(dest []byte, value reflect.Value) []byte {
+	dest = binary.AppendUvarint(dest, uint64(value.Len()))
+	for i := 0; i < value.Len(); i++ {
+		dest = v.element.append(dest, value.Index(i))
+	}
+	return dest
+}
+
+func (v variableSliceBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	length, read, err := readLength(src)
+	if err != nil {
+		return 0, err
+	}
+	value.Set(reflect.MakeSlice(value.Type(), length, length))
+	for i := 0; i < length; i++ {
+		elementRead, err := v.element.read(src[read:], value.Index(i))
+		if err != nil {
+			return 0, err
+		}
+		read += elementRead
+	}
+	return read, nil
+}
+
+func (v variableSliceBlueprint) describe(builder io.StringWriter) error {
+	_, err := builder.WriteString("slice(type=")
+	if err != nil {
+		return err
+	}
+	err = v.element.describe(builder)
+	if err != nil {
+		return err
+	}
+	_, err = builder.WriteString("length=variable)")
+	return err
+}
+
+type variableArrayBlueprint struct {
+	length  int
+	element variableBlueprint
+}
+
+func (v variableArrayBlueprint) append(dest []byte, value reflect.Value) []byte {
+	for i := 0; i < v.length; i++ {
+		dest = v.element.append(dest, value.Index(i))
+	}
+	return dest
+}
+
+func (v variableArrayBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	var read int
+	for i := 0; i < v.length; i++ {
+		elementRead, err := v.element.read(src[read:], value.Index(i))
+		if err != nil {
+			return 0, err
+		}
+		read += elementRead
+	}
+	return read, nil
+}
+
+func (v variableArrayBlueprint) describe(builder io.StringWriter) error {
+	_, err := builder.WriteString("array(type=")
+	if err != nil {
+		return err
+	}
+	err = v.element.describe(builder)
+	if err != nil {
+		return err
+	}
+	_, err = builder.WriteString(fmt.Sprintf("length=%d)", v.length))
+	return err
+}
+
+type variablePointerBlueprint struct {
+	element variableBlueprint
+}
+
+func (v variablePointerBlueprint) append(dest []byte, value reflect.Value) []byte {
+	if value.IsNil() {
+		return append(dest, nilPointer)
+	}
+	return v.element.append(append(dest, 1), value.Elem())
+}
+
+func (v variablePointerBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	if len(src) == 0 {
+		return 0, ErrTruncatedData
+	}
+	if src[0] == nilPointer {
+		value.SetZero()
+		return 1, nil
+	}
+	value.Set(reflect.New(value.Type().Elem()))
+	read, err := v.element.read(src[1:], value.Elem())
+	return read + 1, err
+}
+
+func (v variablePointerBlueprint) describe(builder io.StringWriter) error {
+	_, err := builder.WriteString("pointer(")
+	if err != nil {
+		return err
+	}
+	err = v.element.describe(builder)
+	if err != nil {
+		return err
+	}
+	_, err = builder.WriteString(")")
+	return err
+}
+
+type variableField struct {
+	variableBlueprint
+	fieldIndex int
+}
+
+type variableStructBlueprint struct {
+	structType reflect.Type
+	fields     []variableField
+}
+
+func (v variableStructBlueprint) append(dest []byte, value reflect.Value) []byte {
+	for _, field := range v.fields {
+		dest = field.append(dest, value.Field(field.fieldIndex))
+	}
+	return dest
+}
+
+func (v variableStructBlueprint) read(src []byte, value reflect.Value) (int, error) {
+	var read int
+	for _, field := range v.fields {
+		fieldRead, err := field.read(src[read:], value.Field(field.fieldIndex))
+		if err != nil {
+			return 0, err
+		}
+		read += fieldRead
+	}
+	return read, nil
+}
+
+func (v variableStructBlueprint) describe(builder io.StringWriter) error {
+	_, err := builder.WriteString("struct(type=")
+	if err != nil {
+		return err
+	}
+	if written, _ := builder.WriteString(v.structType.PkgPath()); written > 0 {
+		_, err = builder.WriteString(":")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = builder.WriteString(v.structType.Name())
+	if err != nil {
+		return err
+	}
+	_, err = builder.WriteString("fields=[")
+	if err != nil {
+		return err
+	}
+	for i, field := range v.fields {
+		if i > 0 {
+			_, err = builder.WriteString(",")
+			if err != nil {
+				return err
+			}
+		}
+		err = field.describe(builder)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = builder.WriteString("])")
+	return err
+}
@@ -0,0 +1,65 @@
+package encoding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariableSerializer(t *testing.T) {
+	t.Parallel()
+	type document struct {
+		Title   string
+		Body    []byte
+		Tags    []string
+		Parent  *uint32
+		Scores  [2]float64
+		Ignored string `eternal:"ignored"`
+		Size    string `eternal:"size=2"` // size tag is ignored
+	}
+	serializer, err := CreateVariable[document]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type Scenario struct {
+		Name  string
+		Value document
+	}
+	scenarios := []Scenario{
+		{Name: "empty", Value: document{Body: []byte{}, Tags: []string{}}},
+		{
+			Name: "filled",
+			Value: document{
+				Title:  "eternal",
+				Body:   []byte(strings.Repeat("long body ", 1000)),
+				Tags:   []string{"a", "", "ccc"},
+				Parent: pointer[uint32](7),
+				Scores: [2]float64{1.5, -2},
+				Size:   "longer than two bytes",
+			},
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			data := serializer.Serialize(scenario.Value)
+			decoded, err := serializer.Deserialize(data)
+			assert.NoError(t, err)
+			assert.Equal(t, scenario.Value, decoded)
+			for cut := 0; cut < len(data); cut += max(1, len(data)/10) {
+				_, err := serializer.Deserialize(data[:cut])
+				assert.ErrorIs(t, err, ErrTruncatedData, "cut at %d", cut)
+			}
+		})
+	}
+
+	type recursive struct {
+		Children []recursive
+	}
+	_, err = CreateVariable[recursive]()
+	assert.ErrorIs(t, err, ErrRecursiveStructDefinition)
+	_, err = CreateVariable[map[string]string]()
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+}
@@ -0,0 +1,214 @@
+package eternal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// File
+// Holds data file or write-ahead log of PersistentStorage. Files on disk are adapted by OSFile, MemoryFile keeps data
+// in memory. Other implementations can e.g. encrypt data or wrap block device, file which cannot report its size
+// is adapted by MeasuredFile. Storage closes file implementing io.Closer when it is closed.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+	Size() (int64, error)
+}
+
+var (
+	_ File = OSFile{}
+	_ File = &MemoryFile{}
+	_ File = MeasuredFile{}
+)
+
+// OSFile
+// Adapts *os.File to File.
+type OSFile struct {
+	*os.File
+}
+
+func (f OSFile) Size() (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// MeasuredFile
+// Adapts file without Size method to File. Size is found by reading single bytes around the end of file, which
+// takes tens of reads, so it should be used only when file has no cheaper way to obtain its size.
+type MeasuredFile struct {
+	Unsized interface {
+		io.ReaderAt
+		io.WriterAt
+		Truncate(size int64) error
+		Sync() error
+	}
+}
+
+func (m MeasuredFile) ReadAt(data []byte, offset int64) (int, error) {
+	return m.Unsized.ReadAt(data, offset)
+}
+
+func (m MeasuredFile) WriteAt(data []byte, offset int64) (int, error) {
+	return m.Unsized.WriteAt(data, offset)
+}
+
+func (m MeasuredFile) Truncate(size int64) error {
+	return m.Unsized.Truncate(size)
+}
+
+func (m MeasuredFile) Sync() error {
+	return m.Unsized.Sync()
+}
+
+func (m MeasuredFile) Size() (int64, error) {
+	return measureByReads(m.Unsized)
+}
+
+// Close
+// Closes adapted file, if it implements io.Closer.
+func (m MeasuredFile) Close() error {
+	if closer, ok := m.Unsized.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// MemoryFile
+// File stored in memory, zero value is empty file. It is safe for concurrent use.
+type MemoryFile struct {
+	lock sync.RWMutex
+	data []byte
+}
+
+// NewMemoryFile
+// Creates file with copy of given content.
+func NewMemoryFile(content []byte) *MemoryFile {
+	return &MemoryFile{data: append([]byte(nil), content...)}
+}
+
+func (m *MemoryFile) ReadAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	read := copy(data, m.data[offset:])
+	if read < len(data) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (m *MemoryFile) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if end := offset + int64(len(data)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	return copy(m.data[offset:], data), nil
+}
+
+func (m *MemoryFile) Truncate(size int64) error {
+	if size < 0 {
+		return errors.New("negative size")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if size > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, size-int64(len(m.data)))...)
+	} else {
+		clear(m.data[size:])
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+// Sync
+// Does nothing, memory file is never persisted.
+func (m *MemoryFile) Sync() error {
+	return nil
+}
+
+func (m *MemoryFile) Size() (int64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return int64(len(m.data)), nil
+}
+
+// Bytes
+// Returns copy of the file content.
+func (m *MemoryFile) Bytes() []byte {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]byte(nil), m.data...)
+}
+
+// readerSize
+// Returns size of data read by Probe, which accepts any io.ReaderAt. Data without Size or Stat method is measured
+// by reads.
+func readerSize(data io.ReaderAt) (int64, error) {
+	switch sized := data.(type) {
+	case interface{ Size() int64 }:
+		return sized.Size(), nil
+	case interface{ Size() (int64, error) }:
+		return sized.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		stat, err := sized.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return stat.Size(), nil
+	}
+	return measureByReads(data)
+}
+
+// measureByReads
+// Returns size of data by reading single bytes, offset past the end is found by doubling and the end itself
+// by binary search.
+func measureByReads(data io.ReaderAt) (int64, error) {
+	readable := func(offset int64) (bool, error) {
+		_, err := data.ReadAt(make([]byte, 1), offset)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	var end int64 = 1
+	for {
+		found, err := readable(end - 1)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			break
+		}
+		end *= 2
+	}
+	low, high := end/2, end-1 // byte at low-1 is readable or low is zero, byte at high is not
+	for low < high {
+		middle := low + (high-low)/2
+		found, err := readable(middle)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+	return low, nil
+}
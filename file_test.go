@@ -0,0 +1,94 @@
+package eternal
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zelezo001/eternal/encoding"
+)
+
+func TestMemoryFile(t *testing.T) {
+	t.Parallel()
+	file := NewMemoryFile([]byte("eternal"))
+	written, err := file.WriteAt([]byte("ly"), 9)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Equal(t, []byte("eternal\x00\x00ly"), file.Bytes())
+
+	data := make([]byte, 4)
+	read, err := file.ReadAt(data, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, read)
+	assert.Equal(t, []byte("erna"), data)
+	read, err = file.ReadAt(data, 9)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 2, read)
+	_, err = file.ReadAt(data, 11)
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.NoError(t, file.Truncate(3))
+	size, err := file.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), size)
+	assert.NoError(t, file.Truncate(5))
+	// truncated bytes are not visible after file grows again
+	assert.Equal(t, []byte("ete\x00\x00"), file.Bytes())
+	assert.NoError(t, file.Sync())
+}
+
+// unsizedFile
+// File without Size and Stat methods, which must be adapted by MeasuredFile.
+type unsizedFile struct {
+	file *MemoryFile
+}
+
+func (u unsizedFile) ReadAt(data []byte, offset int64) (int, error) {
+	return u.file.ReadAt(data, offset)
+}
+
+func (u unsizedFile) WriteAt(data []byte, offset int64) (int, error) {
+	return u.file.WriteAt(data, offset)
+}
+
+func (u unsizedFile) Truncate(size int64) error {
+	return u.file.Truncate(size)
+}
+
+func (u unsizedFile) Sync() error {
+	return u.file.Sync()
+}
+
+func TestMeasuredFile(t *testing.T) {
+	t.Parallel()
+	for _, size := range []int{0, 1, 2, 5, 64, 1000} {
+		file := NewMemoryFile(make([]byte, size))
+		measured, err := MeasuredFile{unsizedFile{file}}.Size()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), measured)
+		measured, err = readerSize(unsizedFile{file})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), measured)
+	}
+
+	// storage works with file measured by reads
+	file := MeasuredFile{unsizedFile{&MemoryFile{}}}
+	serializer := encoding.CreateForPrimitive[int64]()
+	storage, err := NewPersistentStorage[int64, int64](2, 3, 64, file, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTreeFromStorage[int64, int64](storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 50; i++ {
+		assert.NoError(t, tree.Insert(i, -i))
+	}
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	assert.Equal(t, 50, report.Values)
+}
@@ -2,7 +2,6 @@ package eternal
 
 import (
 	"cmp"
-	"errors"
 
 	"github.com/zelezo001/eternal/internal/stack"
 )
@@ -43,7 +42,7 @@ func (i *InMemoryStorage[K, V]) GetRoot() (Node[K, V], error) {
 func (i *InMemoryStorage[K, V]) Get(id uint) (Node[K, V], error) {
 	node, found := i.nodes[id]
 	if !found {
-		return Node[K, V]{}, errors.New("node not found")
+		return Node[K, V]{}, ErrMissingNode
 	}
 	return node, nil
 }
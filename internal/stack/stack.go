@@ -28,3 +28,17 @@ func (receiver *Stack[T]) Count() uint {
 func (receiver *Stack[T]) Empty() bool {
 	return len(receiver.values) == 0
 }
+
+// Peek
+// Returns pointer to the value on top of the stack, so it can be modified in place.
+// Pointer is valid only until the next Push.
+func (receiver *Stack[T]) Peek() *T {
+	return &receiver.values[len(receiver.values)-1]
+}
+
+// Clear
+// Removes all values while keeping allocated capacity, removed values are zeroed so they can be garbage collected.
+func (receiver *Stack[T]) Clear() {
+	clear(receiver.values)
+	receiver.values = receiver.values[:0]
+}
@@ -4,11 +4,12 @@ import (
 	"cmp"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"math/bits"
-	"os"
 	"slices"
+	"time"
 
 	"github.com/zelezo001/eternal/encoding"
 )
@@ -23,25 +24,35 @@ type (
 		Version    version
 		BlockSize  int64
 		Signature  signature
-		System     byte // 64/32
+		System     byte // 64/32, only files older than portableVersion depend on it
 		A, B       uint64
 	}
 )
 
 const (
 	rootId         uint    = 0
-	currentVersion version = 1
+	currentVersion version = 5
 	noFreeId               = 0
+	// checksumVersion is the first version storing checksum of every node
+	checksumVersion version = 2
+	// schemaVersion is the first version storing schema section after tree metadata
+	schemaVersion version = 3
 )
 
 var eternalIdentifier = identifier{'e', 't', 'e', 'r', 'n', 'a', 'l'}
 
+// ErrSchemaMismatch is returned when data file was created for different data type, see Migrate
+var ErrSchemaMismatch = errors.New("signature between current data type and data file differs")
+
 var (
-	headerSerializer encoding.Serializer[header]
-	boolSerializer   = encoding.CreateForPrimitive[bool]()
-	uintSerializer   = encoding.CreateForPrimitive[uint]()
+	headerSerializer   encoding.Serializer[header]
+	lengthSerializer   = encoding.CreateForPrimitive[uint32]()
+	boolSerializer     = encoding.CreateForPrimitive[bool]()
+	checksumSerializer = encoding.CreateForPrimitive[uint32]()
+	crcTable           = crc32.MakeTable(crc32.Castagnoli)
 
-	_ NodeStorage[string, any] = &PersistentStorage[string, any]{}
+	_ ParametrizedStorage[string, any] = &PersistentStorage[string, any]{}
+	_ CountingStorage                  = &PersistentStorage[string, any]{}
 )
 
 func init() {
@@ -53,23 +64,22 @@ func init() {
 }
 
 func checkHeader(header header, schemaSignature signature, a, b uint, blockSize int64) error {
-	if header.Identifier == eternalIdentifier {
+	if header.Identifier != eternalIdentifier {
 		return errors.New("file is not eternal data file")
 	}
-	if header.Version != currentVersion {
+	if header.Version == 0 || header.Version > currentVersion {
 		return fmt.Errorf("data file with version %d is not compatible with current version %d", header.Version,
 			currentVersion)
 	}
 	if schemaSignature != header.Signature {
-		return errors.New("signature between current data type and data file differs")
+		return ErrSchemaMismatch
 	}
 	if header.A != uint64(a) || header.B != uint64(b) {
 		return fmt.Errorf("data file was created for (%d,%d)-tree but current tree is (%d,%d)-tree", header.A, header.B,
 			a, b)
 	}
-	if bits.UintSize != uint(header.System) {
-		return fmt.Errorf("data file was created with %d bits uint, but current system uses %d bits uint",
-			header.System, bits.UintSize)
+	if _, err := idCodecFor(header.Version, header.System); err != nil {
+		return err
 	}
 	if header.BlockSize != blockSize {
 		return fmt.Errorf("data file was created for block size %d, block size %d given", header.BlockSize, blockSize)
@@ -78,38 +88,144 @@ func checkHeader(header header, schemaSignature signature, a, b uint, blockSize
 }
 
 func (p *PersistentStorage[K, V]) loadMetadata() error {
-	_, err := p.file.Seek(int64(headerSerializer.Size()), io.SeekStart)
-	if err != nil {
+	var metaBytes = make([]byte, p.ids.Size()*2)
+	if err := p.readAt(metaBytes, p.depthAddress); err != nil {
 		return err
 	}
-	var metaBytes = make([]byte, uintSerializer.Size()*2)
-	_, err = p.file.Read(metaBytes)
+	p.depth = p.ids.Deserialize(metaBytes)
+	p.freeId = p.ids.Deserialize(metaBytes[p.ids.Size():])
+	return nil
+}
+
+// readHeader
+// Reads header of data file. Empty file is reported by io.EOF.
+func readHeader(file io.ReaderAt) (header, error) {
+	headerBytes := make([]byte, headerSerializer.Size())
+	readHeaderBytes, err := file.ReadAt(headerBytes, 0)
+	if err == nil {
+		return headerSerializer.Deserialize(headerBytes), nil
+	} else if readHeaderBytes != 0 || !errors.Is(err, io.EOF) {
+		return header{}, fmt.Errorf("could not read header from data file: %w", err)
+	}
+	return header{}, io.EOF
+}
+
+// schemaAddress
+// Schema section follows header and tree metadata.
+func schemaAddress(ids idCodec) int64 {
+	return int64(headerSerializer.Size() + ids.Size()*2)
+}
+
+// readSchemaSection
+// Reads description of schema stored in file with given header and returns address of the first node.
+// Files older than schemaVersion do not store schema, empty description is returned for them.
+func readSchemaSection(file io.ReaderAt, stored header) (string, int64, error) {
+	ids, err := idCodecFor(stored.Version, stored.System)
+	if err != nil {
+		return "", 0, err
+	}
+	if stored.Version < schemaVersion {
+		return "", schemaAddress(ids), nil
+	}
+	lengthBytes := make([]byte, lengthSerializer.Size())
+	if _, err := file.ReadAt(lengthBytes, schemaAddress(ids)); err != nil {
+		return "", 0, err
+	}
+	length := lengthSerializer.Deserialize(lengthBytes)
+	size, err := readerSize(file)
 	if err != nil {
-		return err
+		return "", 0, err
 	}
-	p.depth = uintSerializer.Deserialize(metaBytes)
-	p.freeId = uintSerializer.Deserialize(metaBytes[uintSerializer.Size():])
-	return nil
+	descriptionAddress := schemaAddress(ids) + int64(lengthSerializer.Size())
+	if descriptionAddress+int64(length) > size {
+		return "", 0, errors.New("schema section exceeds data file")
+	}
+	description := make([]byte, length)
+	if _, err := file.ReadAt(description, descriptionAddress); err != nil {
+		return "", 0, err
+	}
+	return string(description), descriptionAddress + int64(length), nil
 }
 
-// checkFile
-// Checks if file is compatible and set its offset after header. If file is empty, checkFile innit it.
-func (p *PersistentStorage[K, V]) checkFile(blockSize int64) error {
-	_, err := p.file.Seek(0, io.SeekStart)
+// readStoredSchema
+// Reads header of data file opened without knowledge of its types and parses schema stored in it.
+// Returns header, schema and address of the first node.
+func readStoredSchema(file File) (header, encoding.Schema, int64, error) {
+	stored, err := readStoredHeader(file)
 	if err != nil {
-		return err
+		return header{}, encoding.Schema{}, 0, err
 	}
-	schemaSignature := p.valuesSerializer.Signature()
-	headerBytes := make([]byte, headerSerializer.Size())
-	readHeaderBytes, err := p.file.Read(headerBytes)
+	if stored.Version < schemaVersion {
+		return header{}, encoding.Schema{}, 0, fmt.Errorf("data file with version %d does not store its schema",
+			stored.Version)
+	}
+	schema, baseNodeAddress, err := parseSchemaSection(file, stored)
+	if err != nil {
+		return header{}, encoding.Schema{}, 0, err
+	}
+	return stored, schema, baseNodeAddress, nil
+}
+
+// readStoredHeader
+// Reads header of data file opened without knowing its parameters and checks its identifier and version.
+func readStoredHeader(file File) (header, error) {
+	stored, err := readHeader(file)
+	if errors.Is(err, io.EOF) {
+		return header{}, errors.New("data file is empty")
+	}
+	if err != nil {
+		return header{}, err
+	}
+	switch {
+	case stored.Identifier != eternalIdentifier:
+		return header{}, errors.New("file is not eternal data file")
+	case stored.Version == 0 || stored.Version > currentVersion:
+		return header{}, fmt.Errorf("data file with version %d is not compatible with current version %d",
+			stored.Version, currentVersion)
+	}
+	return stored, nil
+}
+
+// parseSchemaSection
+// Reads and parses schema stored in file with given header, returns it with address of the first node.
+func parseSchemaSection(file File, stored header) (encoding.Schema, int64, error) {
+	description, baseNodeAddress, err := readSchemaSection(file, stored)
+	if err != nil {
+		return encoding.Schema{}, 0, fmt.Errorf("could not read schema from data file: %w", err)
+	}
+	schema, err := encoding.ParseSchema(description)
+	if err != nil {
+		return encoding.Schema{}, 0, err
+	}
+	return schema, baseNodeAddress, nil
+}
+
+// writeSchema
+// Writes schema section of new file, nodes must not be stored yet.
+func (p *PersistentStorage[K, V]) writeSchema(description string) error {
+	section := append(lengthSerializer.Serialize(uint32(len(description))), description...)
+	p.baseNodeAddress = schemaAddress(p.ids) + int64(len(section))
+	return p.writeAt(section, schemaAddress(p.ids))
+}
+
+// checkFile
+// Checks if file is compatible. If file is empty, checkFile innit it.
+func (p *PersistentStorage[K, V]) checkFile(blockSize int64) error {
+	schemaSignature := p.values.signature()
+	stored, err := readHeader(p.file)
 	if err == nil {
-		header := headerSerializer.Deserialize(headerBytes)
-		if err := checkHeader(header, schemaSignature, p.a, p.b, blockSize); err != nil {
+		if err := checkHeader(stored, schemaSignature, p.a, p.b, blockSize); err != nil {
 			return fmt.Errorf("header in provided file is not valid: %w", err)
 		}
+		if err := p.setLayout(stored); err != nil {
+			return err
+		}
+		if _, p.baseNodeAddress, err = readSchemaSection(p.file, stored); err != nil {
+			return fmt.Errorf("could not read schema from data file: %w", err)
+		}
 		return p.loadMetadata()
-	} else if readHeaderBytes != 0 || !errors.Is(err, io.EOF) {
-		return fmt.Errorf("could not read header from data file: %w", err)
+	} else if !errors.Is(err, io.EOF) {
+		return err
 	}
 	// file is empty, we must set default values
 	header := header{
@@ -121,7 +237,7 @@ func (p *PersistentStorage[K, V]) checkFile(blockSize int64) error {
 		B:          uint64(p.b),
 		System:     bits.UintSize,
 	}
-	_, err = p.file.Write(headerSerializer.Serialize(header))
+	err = p.writeAt(headerSerializer.Serialize(header), 0)
 	if err != nil {
 		return err
 	}
@@ -133,6 +249,10 @@ func (p *PersistentStorage[K, V]) checkFile(blockSize int64) error {
 	if err != nil {
 		return err
 	}
+	err = p.writeSchema(p.values.schema().String())
+	if err != nil {
+		return err
+	}
 	id, err := p.NewId()
 	if err != nil {
 		return err
@@ -148,68 +268,238 @@ func (p *PersistentStorage[K, V]) checkFile(blockSize int64) error {
 	})
 }
 
+// StorageOption
+// Configures optional behaviour of PersistentStorage.
+type StorageOption func(options *storageOptions)
+
+type storageOptions struct {
+	log          File
+	truncate     bool
+	memoryMap    bool
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+}
+
+// WithTruncation
+// Restores behaviour of older versions, strings and slices longer than their declared length are silently truncated
+// instead of rejected with encoding.ErrValueTooLarge.
+func WithTruncation() StorageOption {
+	return func(options *storageOptions) {
+		options.truncate = true
+	}
+}
+
 // NewPersistentStorage
 // Creates eternal persistent storage from provided file and config. If file already contains incompatible data, error is returned.
 // If file is empty, new storage is prepared in it. For file without block alignment, pass blockSize <= 0
 func NewPersistentStorage[K cmp.Ordered, V any](
-	a, b uint, blockSize int64, file *os.File, keySerializer encoding.Serializer[K],
-	valueSerializer encoding.Serializer[V],
+	a, b uint, blockSize int64, file File, keySerializer encoding.Serializer[K],
+	valueSerializer encoding.Serializer[V], options ...StorageOption,
 ) (
 	*PersistentStorage[K, V], error,
 ) {
 	blockSize = max(1, blockSize)
-	if b >= math.MaxUint32 {
-		return nil, errors.New("b parameter must be less than max uint32")
-	}
-	tupleSerializer := encoding.CreateForTuple(keySerializer, valueSerializer)
-	valuesEncoder, err := encoding.CreateSliceForSerializer(tupleSerializer, uint32(b-1))
+	values, err := newInlineValues(b, keySerializer, valueSerializer)
 	if err != nil {
-		return nil, fmt.Errorf("could not create serializer for encoding of values: %w", err)
+		return nil, err
+	}
+	return openPersistentStorage(a, b, blockSize, file, values, options...)
+}
+
+// OpenPersistentStorage
+// Opens storage in existing data file with parameters a, b and block size read from its header, they are available
+// by Parameters and BlockSize. Empty file is rejected, as there are no parameters to initialize it with.
+func OpenPersistentStorage[K cmp.Ordered, V any](
+	file File, keySerializer encoding.Serializer[K], valueSerializer encoding.Serializer[V],
+	options ...StorageOption,
+) (
+	*PersistentStorage[K, V], error,
+) {
+	stored, err := readHeader(file)
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("data file is empty")
 	}
-	childrenEncoder, err := encoding.CreateForSlice[[]uint, uint](uint32(b))
 	if err != nil {
-		return nil, fmt.Errorf("could not create serializer for encoding of child ids: %w", err)
+		return nil, err
 	}
+	return NewPersistentStorage[K, V](uint(stored.A), uint(stored.B), stored.BlockSize, file, keySerializer,
+		valueSerializer, options...)
+}
 
-	nodeSize := valuesEncoder.Size() + childrenEncoder.Size()
-	nodeSize = max(nodeSize, uintSerializer.Size()) + boolSerializer.Size()
+// openPersistentStorage
+// Prepares storage and checks or initializes its file.
+func openPersistentStorage[K cmp.Ordered, V any](
+	a, b uint, blockSize int64, file File, values valuesCodec[K, V], options ...StorageOption,
+) (
+	*PersistentStorage[K, V], error,
+) {
+	storage, err := newPersistentStorage(a, b, blockSize, file, values, options...)
+	if err != nil {
+		return nil, err
+	}
+	if storage.log != nil {
+		if err := storage.replayLog(); err != nil {
+			return nil, fmt.Errorf("could not replay write-ahead log: %w", err)
+		}
+	}
+	// initialization of new file is done atomically as well
+	if err := storage.Begin(); err != nil {
+		return nil, err
+	}
+	if err := storage.checkFile(blockSize); err != nil {
+		return storage, errors.Join(err, storage.Rollback())
+	}
+	if err := storage.Commit(); err != nil {
+		return storage, err
+	}
+	if storage.durability != nil {
+		// metadata of new file must be written
+		if err := storage.Sync(); err != nil {
+			return storage, err
+		}
+		storage.startSync()
+	}
+	return storage, nil
+}
 
-	// we want nodes to be aligned with paddedNodeSize, so we can easily translate between address and id
-	metadataSize := uintSerializer.Size() * 2
-	paddedNodeSize := calculatePaddedNodeSize(int64(nodeSize), blockSize)
+// newPersistentStorage
+// Prepares storage with layout given by config without touching the file.
+func newPersistentStorage[K cmp.Ordered, V any](
+	a, b uint, blockSize int64, file File, values valuesCodec[K, V], options ...StorageOption,
+) (
+	*PersistentStorage[K, V], error,
+) {
+	if b >= math.MaxUint32 {
+		return nil, errors.New("b parameter must be less than max uint32")
+	}
 
-	depthAddress := int64(headerSerializer.Size())
-	freeIdAddress := depthAddress + int64(uintSerializer.Size())
+	var config storageOptions
+	for _, option := range options {
+		option(&config)
+	}
 
 	storage := &PersistentStorage[K, V]{
-		nodeSize:           int64(nodeSize),
-		file:               file,
-		depthAddress:       depthAddress,
-		freeIdAddress:      freeIdAddress,
-		baseNodeAddress:    int64(metadataSize + headerSerializer.Size()),
-		valuesSerializer:   valuesEncoder,
-		childrenSerializer: childrenEncoder,
-		paddedNodeSize:     paddedNodeSize,
-		a:                  a,
-		b:                  b,
+		file:      file,
+		log:       config.log,
+		truncate:  config.truncate,
+		values:    values,
+		blockSize: blockSize,
+		a:         a,
+		b:         b,
+	}
+	switch config.syncPolicy {
+	case 0:
+	case SyncManually, SyncEveryOperation, SyncPeriodically:
+		if config.syncPolicy == SyncPeriodically && config.syncInterval <= 0 {
+			return nil, errors.New("interval of periodic sync must be positive")
+		}
+		storage.durability = &durability{policy: config.syncPolicy, interval: config.syncInterval}
+	default:
+		return nil, fmt.Errorf("unknown sync policy %d", config.syncPolicy)
 	}
-	return storage, storage.checkFile(blockSize)
+	if config.memoryMap {
+		mapping, err := newMemoryMap(file)
+		if err != nil {
+			return nil, err
+		}
+		storage.mapping = mapping
+	}
+	// new files are created with current version, layout of existing file is set after its header is read
+	if err := storage.setLayout(header{Version: currentVersion, System: bits.UintSize}); err != nil {
+		return nil, err
+	}
+	schemaSectionSize := lengthSerializer.Size() + uint(len(values.schema().String()))
+	storage.baseNodeAddress = schemaAddress(storage.ids) + int64(schemaSectionSize)
+	return storage, nil
+}
+
+// setLayout
+// Computes size of nodes and addresses of tree metadata for data file with given header.
+func (p *PersistentStorage[K, V]) setLayout(stored header) error {
+	ids, err := idCodecFor(stored.Version, stored.System)
+	if err != nil {
+		return err
+	}
+	p.ids = ids
+	p.childrenSerializer = childrenCodec{ids: ids, b: p.b, counts: stored.Version >= countsVersion}
+
+	p.checksums = stored.Version >= checksumVersion
+
+	nodeSize := p.values.size() + p.childrenSerializer.Size()
+	if p.checksums {
+		nodeSize += checksumSerializer.Size()
+	}
+	nodeSize = max(nodeSize, ids.Size()) + boolSerializer.Size()
+	p.nodeSize = int64(nodeSize)
+	// we want nodes to be aligned with paddedNodeSize, so we can easily translate between address and id
+	p.paddedNodeSize = calculatePaddedNodeSize(p.nodeSize, p.blockSize)
+
+	p.depthAddress = int64(headerSerializer.Size())
+	return nil
 }
 
 type PersistentStorage[K cmp.Ordered, V any] struct {
-	nodeSize                    int64
-	paddedNodeSize              int64
-	a, b                        uint
-	file                        *os.File
-	depth, freeId               uint  // id which is not occupied in file but is allocated
-	depthAddress, freeIdAddress int64 // addresses for tree metadata
-	baseNodeAddress             int64 // part of file where nodes are stored
-	valuesSerializer            encoding.Serializer[[]encoding.Tuple[K, V]]
-	childrenSerializer          encoding.Serializer[[]uint]
+	nodeSize           int64
+	paddedNodeSize     int64
+	blockSize          int64
+	a, b               uint
+	file               File
+	log                File        // optional write-ahead log
+	mapping            *memoryMap  // optional mapping of file serving reads
+	chains             *chainCache // data of overflow page chains, only storage with overflow pages has it
+	durability         *durability // optional policy of syncing file
+	batch              *writeBatch // writes of atomic operation in progress
+	depth, freeId      uint        // id which is not occupied in file but is allocated
+	depthAddress       int64       // address of tree metadata, depth is followed by free id
+	baseNodeAddress    int64       // part of file where nodes are stored, it follows schema section
+	values             valuesCodec[K, V]
+	ids                idCodec // encoding of ids and tree metadata given by version of file
+	childrenSerializer childrenCodec
+	checksums          bool // nodes are stored with checksum, files older than checksumVersion have none
+	truncate           bool // strings and slices over declared length are truncated instead of rejected
+}
+
+// CountsSubtrees
+// See CountingStorage, only files of version 5 and newer store counts of values in subtrees.
+func (p *PersistentStorage[K, V]) CountsSubtrees() bool {
+	return p.childrenSerializer.counts
+}
+
+// Parameters
+// Returns parameters a and b of stored tree.
+func (p *PersistentStorage[K, V]) Parameters() (a, b uint) {
+	return p.a, p.b
+}
+
+// BlockSize
+// Returns block size nodes are aligned to, one means nodes are not aligned.
+func (p *PersistentStorage[K, V]) BlockSize() int64 {
+	return p.blockSize
 }
 
 func (p *PersistentStorage[K, V]) Close() error {
-	return p.file.Close()
+	err := p.stopSync()
+	if p.mapping != nil {
+		err = errors.Join(err, p.mapping.Close())
+	}
+	if closer, ok := p.log.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	if closer, ok := p.file.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// CheckValue
+// Returns encoding.ValueTooLargeError if key or value contains string or slice longer than its declared length.
+// Path in error is relative to encoding.Tuple of key and value.
+// Storage created with WithTruncation accepts every value.
+func (p *PersistentStorage[K, V]) CheckValue(key K, value V) error {
+	if p.truncate {
+		return nil
+	}
+	return p.values.check(encoding.Tuple[K, V]{First: key, Second: value})
 }
 
 func (p *PersistentStorage[K, V]) GetRoot() (Node[K, V], error) {
@@ -222,121 +512,180 @@ func (p *PersistentStorage[K, V]) GetDepth() uint {
 
 func (p *PersistentStorage[K, V]) SetDepth(depth uint) error {
 	p.depth = depth
-	_, err := p.file.WriteAt(uintSerializer.Serialize(p.depth), p.depthAddress)
-	return err
+	return p.writeMetadata()
+}
+
+var (
+	ErrMissingNode   = errors.New("node not found")
+	ErrCorruptedNode = errors.New("node is corrupted")
+
+	errOverflowPage = fmt.Errorf("%w: slot holds overflow page", ErrMissingNode)
+)
+
+// first byte of every slot
+const (
+	freeMarker byte = iota
+	nodeMarker
+	pageMarker
+)
+
+// CorruptedNodeError
+// Returned when stored node does not match its checksum, e.g. after torn write. Matches ErrCorruptedNode.
+type CorruptedNodeError struct {
+	Id uint
+}
+
+func (c *CorruptedNodeError) Error() string {
+	return fmt.Sprintf("node with id %d is corrupted", c.Id)
 }
 
-var ErrMissingNode = errors.New("node not found")
+func (c *CorruptedNodeError) Is(target error) bool {
+	return target == ErrCorruptedNode
+}
 
 func (p *PersistentStorage[K, V]) Get(id uint) (Node[K, V], error) {
-	offset := p.idToOffset(id)
-	_, err := p.file.Seek(offset, io.SeekStart)
+	nodeData, err := p.readPayload(id)
 	if err != nil {
 		return Node[K, V]{}, err
 	}
-	var nodeData = make([]byte, p.nodeSize)
-	_, err = p.file.Read(nodeData)
+	values, err := p.values.decode(p, nodeData)
 	if err != nil {
 		return Node[K, V]{}, err
 	}
-	inUse := boolSerializer.Deserialize(nodeData)
-	if !inUse {
-		return Node[K, V]{}, ErrMissingNode
-	}
-	nodeData = nodeData[boolSerializer.Size():]
-	values := p.valuesSerializer.Deserialize(nodeData)
-	children := p.childrenSerializer.Deserialize(nodeData[p.valuesSerializer.Size():])
+	children, counts := p.childrenSerializer.Deserialize(nodeData[p.values.size():])
 	if len(children) != 0 {
 		children = slices.Grow(children, int(p.b+1))
 	}
+	if counts != nil {
+		counts = slices.Grow(counts, int(p.b+1))
+	}
 	return Node[K, V]{
 		id:       id,
 		values:   slices.Grow(values, int(p.b)),
 		children: children,
+		counts:   counts,
 		leaf:     len(children) == 0,
 	}, nil
 }
 
 func (p *PersistentStorage[K, V]) Persist(node Node[K, V]) error {
-	offset := p.idToOffset(node.id)
-	_, err := p.file.Seek(offset, io.SeekStart)
+	// values stored out of node only by previous version are released after the new version is written
+	encodedValues, released, err := p.values.encode(p, node.id, node.values)
 	if err != nil {
 		return err
 	}
-	_, err = p.file.Write(boolSerializer.Serialize(true))
-	if err != nil {
+	var payload = make([]byte, 0, p.values.size()+p.childrenSerializer.Size())
+	payload = append(payload, encodedValues...)
+	payload = append(payload, p.childrenSerializer.Serialize(node.children, node.counts)...)
+	if err := p.writePayload(node.id, payload); err != nil {
 		return err
 	}
-	_, err = p.file.Write(p.valuesSerializer.Serialize(node.values))
-	if err != nil {
-		return err
+	return p.freePages(released)
+}
+
+// readPayload
+// Reads values and children of node in use and verifies them against stored checksum, if file stores checksums.
+func (p *PersistentStorage[K, V]) readPayload(id uint) ([]byte, error) {
+	var nodeData = make([]byte, p.nodeSize)
+	if err := p.readAt(nodeData, p.idToOffset(id)); err != nil {
+		return nil, err
 	}
-	_, err = p.file.Write(p.childrenSerializer.Serialize(node.children))
-	return err
+	switch nodeData[0] {
+	case nodeMarker:
+	case pageMarker:
+		return nil, errOverflowPage
+	default:
+		return nil, ErrMissingNode
+	}
+	nodeData = nodeData[boolSerializer.Size():]
+	payloadSize := p.values.size() + p.childrenSerializer.Size()
+	if !p.checksums {
+		return nodeData[:payloadSize], nil
+	}
+	checksum := checksumSerializer.Deserialize(nodeData)
+	payload := nodeData[checksumSerializer.Size() : checksumSerializer.Size()+payloadSize]
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, &CorruptedNodeError{Id: id}
+	}
+	return payload, nil
+}
+
+// writePayload
+// Writes node in use with given values and children together with their checksum, if file stores checksums.
+func (p *PersistentStorage[K, V]) writePayload(id uint, payload []byte) error {
+	var nodeData = make([]byte, 0, p.nodeSize)
+	nodeData = append(nodeData, boolSerializer.Serialize(true)...)
+	if p.checksums {
+		nodeData = append(nodeData, checksumSerializer.Serialize(crc32.Checksum(payload, crcTable))...)
+	}
+	nodeData = append(nodeData, payload...)
+	return p.writeAt(nodeData, p.idToOffset(id))
 }
 
 func (p *PersistentStorage[K, V]) Remove(id uint) error {
 	if id == rootId {
 		return errors.New("cannot remove root")
 	}
-	offset := p.idToOffset(id)
-	_, err := p.file.Seek(offset, io.SeekStart)
+	pages, err := p.values.pages(p, id)
 	if err != nil {
 		return err
 	}
-	// lazy delete, proper cleanup will be done during defragmentation or when id is claimed by a new node
-	_, err = p.file.Write(boolSerializer.Serialize(false))
-	if err != nil {
+	if err := p.free(id); err != nil {
 		return err
 	}
-	_, err = p.file.Write(uintSerializer.Serialize(p.freeId))
-	if err != nil {
+	return p.freePages(pages)
+}
+
+// free
+// Adds slot to the chain of free ids.
+func (p *PersistentStorage[K, V]) free(id uint) error {
+	// lazy delete, proper cleanup will be done during defragmentation or when id is claimed by a new node
+	if err := p.writeFreeSlot(id, p.freeId); err != nil {
 		return err
 	}
 
 	return p.updateFreeId(id)
 }
 
+// writeFreeSlot
+// Marks slot as free and links it to the next free id.
+func (p *PersistentStorage[K, V]) writeFreeSlot(id, next uint) error {
+	var freeNodeData = make([]byte, 0, boolSerializer.Size()+p.ids.Size())
+	freeNodeData = append(freeNodeData, boolSerializer.Serialize(false)...)
+	freeNodeData = append(freeNodeData, p.ids.Serialize(next)...)
+	return p.writeAt(freeNodeData, p.idToOffset(id))
+}
+
 func (p *PersistentStorage[K, V]) NewId() (uint, error) {
 	if p.freeId == noFreeId {
 		// no free space is present in file, we must enlarge file
-		address, err := p.file.Seek(0, io.SeekEnd)
+		address, err := p.size()
 		if err != nil {
 			return 0, err
 		}
 		newId := uint((address - p.baseNodeAddress) / p.paddedNodeSize)
-		_, err = p.file.Write(boolSerializer.Serialize(false))
-		if err != nil {
-			return 0, err
-		}
-		_, err = p.file.Write(make([]byte, p.paddedNodeSize-int64(boolSerializer.Size())))
+		// zeroed node is not in use
+		err = p.writeAt(make([]byte, p.paddedNodeSize), address)
 		if err != nil {
 			return 0, err
 		}
 		return newId, nil
 	}
-	offset := p.idToOffset(p.freeId)
-	_, err := p.file.Seek(offset, io.SeekStart)
-	if err != nil {
-		return 0, err
-	}
-	var freeNodeData = make([]byte, boolSerializer.Size()+uintSerializer.Size())
-	_, err = p.file.Read(freeNodeData)
-	if err != nil {
+	var freeNodeData = make([]byte, boolSerializer.Size()+p.ids.Size())
+	if err := p.readAt(freeNodeData, p.idToOffset(p.freeId)); err != nil {
 		return 0, err
 	}
 	if boolSerializer.Deserialize(freeNodeData) {
 		return 0, fmt.Errorf("node with id %d should be free but isn't", p.freeId)
 	}
 	freeId := p.freeId
-	nextFreeId := uintSerializer.Deserialize(freeNodeData[boolSerializer.Size():])
+	nextFreeId := p.ids.Deserialize(freeNodeData[boolSerializer.Size():])
 	return freeId, p.updateFreeId(nextFreeId)
 }
 
 func (p *PersistentStorage[K, V]) updateFreeId(id uint) error {
 	p.freeId = id
-	_, err := p.file.WriteAt(uintSerializer.Serialize(id), p.freeIdAddress)
-	return err
+	return p.writeMetadata()
 }
 
 func (p *PersistentStorage[K, V]) idToOffset(id uint) int64 {
@@ -364,3 +713,70 @@ func calculatePaddedNodeSize(nodeSize, blockSize int64) int64 {
 		return paddedNodeSize
 	}
 }
+
+// valuesCodec
+// Encodes values of node to fixed size part of node slot.
+type valuesCodec[K cmp.Ordered, V any] interface {
+	size() uint
+	signature() signature
+	// schema describes encoded tuple of key and value
+	schema() encoding.Schema
+	// check returns encoding.ValueTooLargeError if value would be truncated
+	check(value encoding.Tuple[K, V]) error
+	// encode returns encoded values of node which replaces node stored in slot with given id, together with first
+	// ids of page chains which are not used by the new node and are released once it is written
+	encode(p *PersistentStorage[K, V], id uint, values values[K, V]) ([]byte, []uint, error)
+	decode(p *PersistentStorage[K, V], data []byte) (values[K, V], error)
+	// pages returns first ids of page chains holding values of node stored in slot with given id
+	pages(p *PersistentStorage[K, V], id uint) ([]uint, error)
+}
+
+// inlineValues
+// Stores values with fixed size directly in node slot.
+type inlineValues[K cmp.Ordered, V any] struct {
+	tupleSerializer encoding.Serializer[encoding.Tuple[K, V]]
+	serializer      encoding.Serializer[[]encoding.Tuple[K, V]]
+}
+
+func newInlineValues[K cmp.Ordered, V any](
+	b uint, keySerializer encoding.Serializer[K], valueSerializer encoding.Serializer[V],
+) (inlineValues[K, V], error) {
+	tupleSerializer := encoding.CreateForTuple(keySerializer, valueSerializer)
+	serializer, err := encoding.CreateSliceForSerializer(tupleSerializer, uint32(b-1))
+	if err != nil {
+		return inlineValues[K, V]{}, fmt.Errorf("could not create serializer for encoding of values: %w", err)
+	}
+	return inlineValues[K, V]{tupleSerializer: tupleSerializer, serializer: serializer}, nil
+}
+
+func (i inlineValues[K, V]) size() uint {
+	return i.serializer.Size()
+}
+
+func (i inlineValues[K, V]) signature() signature {
+	return i.serializer.Signature()
+}
+
+func (i inlineValues[K, V]) schema() encoding.Schema {
+	return i.tupleSerializer.Schema()
+}
+
+func (i inlineValues[K, V]) check(value encoding.Tuple[K, V]) error {
+	return i.tupleSerializer.Check(value)
+}
+
+func (i inlineValues[K, V]) encode(p *PersistentStorage[K, V], _ uint, values values[K, V]) ([]byte, []uint, error) {
+	if p.truncate {
+		return i.serializer.Serialize(values), nil, nil
+	}
+	encoded, err := i.serializer.SerializeChecked(values)
+	return encoded, nil, err
+}
+
+func (i inlineValues[K, V]) decode(_ *PersistentStorage[K, V], data []byte) (values[K, V], error) {
+	return i.serializer.Deserialize(data), nil
+}
+
+func (i inlineValues[K, V]) pages(*PersistentStorage[K, V], uint) ([]uint, error) {
+	return nil, nil
+}
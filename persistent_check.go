@@ -0,0 +1,48 @@
+package eternal
+
+// Check
+// Verifies tree stored in file (see Tree.Verify) and chain of free ids. Free chain must reference only unused nodes
+// inside of file and no node can be reachable from root and free at the same time.
+// Storage must not be modified during check.
+func (p *PersistentStorage[K, V]) Check() (*Report, error) {
+	report, reachable, err := verifyTree[K, V](p, p.a, p.b)
+	if err != nil {
+		return nil, err
+	}
+	size, err := p.size()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nodeCount    = uint((size - p.baseNodeAddress) / p.paddedNodeSize)
+		visited      = make(map[uint]struct{})
+		previousId   uint
+		freeNodeData = make([]byte, boolSerializer.Size()+p.ids.Size())
+	)
+	for id := p.freeId; id != noFreeId; {
+		if id >= nodeCount {
+			report.add(ViolationFreeChain, id, "free id after node %d is outside of file with %d nodes", previousId,
+				nodeCount)
+			break
+		}
+		if _, found := visited[id]; found {
+			report.add(ViolationFreeChain, id, "free chain contains cycle, node follows node %d", previousId)
+			break
+		}
+		visited[id] = struct{}{}
+		if _, found := reachable[id]; found {
+			report.add(ViolationReachableFree, id, "node reachable from root is in free chain")
+		}
+		if err := p.readAt(freeNodeData, p.idToOffset(id)); err != nil {
+			return nil, err
+		}
+		if boolSerializer.Deserialize(freeNodeData) {
+			// next id of node in use is not valid, chain cannot be followed
+			report.add(ViolationFreeChain, id, "free chain references node in use")
+			break
+		}
+		previousId = id
+		id = p.ids.Deserialize(freeNodeData[boolSerializer.Size():])
+	}
+	return report, nil
+}
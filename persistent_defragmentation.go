@@ -2,6 +2,7 @@ package eternal
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/zelezo001/eternal/encoding"
@@ -11,11 +12,17 @@ import (
 // removes fragmentation in file by rearranging nodes.
 // Defragmentation can lead to change in node IDs, so it shouldn't be called in parallel with tree operations
 func (p *PersistentStorage[K, V]) Defragment() error {
+	if p.batch != nil {
+		return errors.New("defragmentation cannot run during batch")
+	}
+	if _, overflow := p.values.(overflowValues[K, V]); overflow {
+		return fmt.Errorf("%w: defragmentation", ErrOverflowUnsupported)
+	}
 	if p.freeId == 0 {
 		// no free id is present, that means no inner address/id is unoccupied and file is not fragmented
 		return nil
 	}
-	lastAddress, err := p.file.Seek(0, io.SeekEnd)
+	lastAddress, err := p.size()
 	if err != nil {
 		return err
 	}
@@ -90,78 +97,55 @@ func (p *PersistentStorage[K, V]) Defragment() error {
 		return err
 	}
 	// offset of firstEmptyNodeId is equal to final size of defragmented file
-	return p.file.Truncate(p.idToOffset(firstEmptyNodeId))
+	return p.truncateFile(p.idToOffset(firstEmptyNodeId))
+}
+
+// truncateFile
+// Truncates data file, mapped region is shrunk first, so truncated part is never read.
+func (p *PersistentStorage[K, V]) truncateFile(size int64) error {
+	if p.mapping != nil {
+		p.mapping.truncate(size)
+	}
+	return p.file.Truncate(size)
 }
 
 func (p *PersistentStorage[K, V]) moveNode(oldId, newId uint) error {
 	var node = make([]byte, p.nodeSize)
-	_, err := p.file.ReadAt(node, p.idToOffset(oldId))
+	err := p.readAt(node, p.idToOffset(oldId))
 	if err != nil {
 		return err
 	}
-	_, err = p.file.WriteAt(node, p.idToOffset(newId))
+	err = p.writeAt(node, p.idToOffset(newId))
 	if err != nil {
 		return err
 	}
 	// mark old as deleted without freeId chain as ve move nodes only during defragmentation
 	// do this as the last step, so we don't lose moved node
-	_, err = p.file.WriteAt(boolSerializer.Serialize(false), p.idToOffset(oldId))
-	if err != nil {
-		return err
-	}
-	return nil
+	return p.writeAt(boolSerializer.Serialize(false), p.idToOffset(oldId))
 }
 
 func (p *PersistentStorage[K, V]) persistWithoutValues(node Node[K, V]) error {
-	offset := p.idToOffset(node.id)
-	_, err := p.file.Seek(offset, io.SeekStart)
-	if err != nil {
-		return err
-	}
-
-	_, err = p.file.Write(boolSerializer.Serialize(true))
-	if err != nil {
-		return err
-	}
-	// skip memory where values are stored
-	_, err = p.file.Seek(int64(p.valuesSerializer.Size()), io.SeekCurrent)
+	payload, err := p.readPayload(node.id)
 	if err != nil {
 		return err
 	}
-	_, err = p.file.Write(p.childrenSerializer.Serialize(node.children))
-	return nil
+	// values are kept as they are stored, only checksum must be computed again
+	copy(payload[p.values.size():], p.childrenSerializer.Serialize(node.children, node.counts))
+	return p.writePayload(node.id, payload)
 }
 
 func (p *PersistentStorage[K, V]) loadWithoutValues(id uint) (Node[K, V], error) {
-	offset := p.idToOffset(id)
-	_, err := p.file.Seek(offset, io.SeekStart)
+	payload, err := p.readPayload(id)
 	if err != nil {
 		return Node[K, V]{}, err
 	}
-	var inUseData = make([]byte, boolSerializer.Size())
-	_, err = p.file.Read(inUseData)
-	if err != nil {
-		return Node[K, V]{}, err
-	}
-	inUse := boolSerializer.Deserialize(inUseData)
-	if !inUse {
-		return Node[K, V]{}, ErrMissingNode
-	}
 	// skip memory where values are stored
-	_, err = p.file.Seek(int64(p.valuesSerializer.Size()), io.SeekCurrent)
-	if err != nil {
-		return Node[K, V]{}, err
-	}
-	var childrenData = make([]byte, p.childrenSerializer.Size())
-	_, err = p.file.Read(childrenData)
-	if err != nil {
-		return Node[K, V]{}, err
-	}
-	children := p.childrenSerializer.Deserialize(childrenData)
+	children, counts := p.childrenSerializer.Deserialize(payload[p.values.size():])
 	return Node[K, V]{
 		id:       id,
 		values:   nil,
 		children: children,
+		counts:   counts,
 		leaf:     len(children) == 0,
 	}, nil
 }
@@ -204,7 +188,7 @@ func (p *PersistentStorage[K, V]) findEmptyBlock(startAt uint) (encoding.Tuple[u
 
 func (p *PersistentStorage[K, V]) checkIfInUse(id uint) (bool, error) {
 	var bytes = make([]byte, boolSerializer.Size())
-	_, err := p.file.ReadAt(bytes, p.idToOffset(id))
+	err := p.readAt(bytes, p.idToOffset(id))
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,206 @@
+package eternal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// DefragmentStep
+// Moves at most budget nodes from the end of file to the lowest free slots and truncates freed end of file.
+// Unlike Defragment, tree and chain of free ids stay consistent after every step, so steps can be interleaved with
+// tree operations (e.g. run in background by ConcurrentTree.Maintain). Step is atomic in storage with write-ahead log.
+// Every step walks whole chain of free ids. Returns true, when there are no free slots left in the file.
+// Moved nodes change their ids, CachedStorage wrapping this storage must be purged before and after every step.
+func (p *PersistentStorage[K, V]) DefragmentStep(budget uint) (bool, error) {
+	if p.batch != nil {
+		return false, errors.New("defragmentation cannot run during batch")
+	}
+	if _, overflow := p.values.(overflowValues[K, V]); overflow {
+		return false, fmt.Errorf("%w: defragmentation", ErrOverflowUnsupported)
+	}
+	if err := p.Begin(); err != nil {
+		return false, err
+	}
+	cut, err := p.defragmentStep(budget)
+	if err != nil {
+		return false, errors.Join(err, p.Rollback())
+	}
+	if err := p.Commit(); err != nil {
+		return false, err
+	}
+	if p.deferMetadata() {
+		// metadata on disk must not reference truncated slots
+		if err := p.Sync(); err != nil {
+			return false, err
+		}
+	}
+	// moved nodes are not referenced anymore, even if truncation fails
+	if err := p.truncateFile(p.idToOffset(cut)); err != nil {
+		return false, err
+	}
+	return p.freeId == noFreeId, nil
+}
+
+// defragmentStep
+// Plans and does moves of one step. Returns id of the first slot which should be truncated.
+func (p *PersistentStorage[K, V]) defragmentStep(budget uint) (uint, error) {
+	size, err := p.size()
+	if err != nil {
+		return 0, err
+	}
+	chain, err := p.freeIds()
+	if err != nil {
+		return 0, err
+	}
+	// the lowest free slots are filled by nodes from the end of file
+	targets := slices.Sorted(slices.Values(chain))
+	var moved []uint
+	lastId := uint((size-p.baseNodeAddress)/p.paddedNodeSize) - 1
+	cut := lastId + 1
+	for id := lastId; id > rootId; id-- {
+		inUse, err := p.checkIfInUse(id)
+		if err != nil {
+			return 0, err
+		}
+		if inUse {
+			if uint(len(moved)) == budget || len(moved) == len(targets) || targets[len(moved)] >= id {
+				break
+			}
+			moved = append(moved, id)
+		} else if len(moved) > 0 && targets[len(moved)-1] >= id {
+			// reserved target cannot be truncated
+			break
+		}
+		cut = id
+	}
+	targets = targets[:len(moved)]
+
+	// free slots which are filled or truncated must not be claimed by NewId
+	removed := make(map[uint]struct{}, len(targets))
+	for _, id := range targets {
+		removed[id] = struct{}{}
+	}
+	var kept []uint
+	for _, id := range chain {
+		if _, found := removed[id]; !found && id < cut {
+			kept = append(kept, id)
+		}
+	}
+	if err := p.relinkFreeChain(chain, kept); err != nil {
+		return 0, err
+	}
+	for i, id := range moved {
+		if err := p.relocateNode(id, targets[i]); err != nil {
+			return 0, err
+		}
+	}
+	return cut, nil
+}
+
+// freeIds
+// Returns ids of free slots in order of the chain.
+func (p *PersistentStorage[K, V]) freeIds() ([]uint, error) {
+	var (
+		chain        []uint
+		visited      = make(map[uint]struct{})
+		freeNodeData = make([]byte, boolSerializer.Size()+p.ids.Size())
+	)
+	for id := p.freeId; id != noFreeId; {
+		if _, found := visited[id]; found {
+			return nil, fmt.Errorf("chain of free ids contains cycle at id %d", id)
+		}
+		visited[id] = struct{}{}
+		if err := p.readAt(freeNodeData, p.idToOffset(id)); err != nil {
+			return nil, err
+		}
+		if boolSerializer.Deserialize(freeNodeData) {
+			return nil, fmt.Errorf("chain of free ids references node %d in use", id)
+		}
+		chain = append(chain, id)
+		id = p.ids.Deserialize(freeNodeData[boolSerializer.Size():])
+	}
+	return chain, nil
+}
+
+// relinkFreeChain
+// Removes ids missing in kept from chain, kept ids must be in the same order as in chain.
+// Only links which change are written.
+func (p *PersistentStorage[K, V]) relinkFreeChain(chain, kept []uint) error {
+	next := make(map[uint]uint, len(chain))
+	for i, id := range chain {
+		next[id] = noFreeId
+		if i+1 < len(chain) {
+			next[id] = chain[i+1]
+		}
+	}
+	var head uint = noFreeId
+	if len(kept) > 0 {
+		head = kept[0]
+	}
+	for i, id := range kept {
+		var following uint = noFreeId
+		if i+1 < len(kept) {
+			following = kept[i+1]
+		}
+		if next[id] != following {
+			if err := p.writeFreeSlot(id, following); err != nil {
+				return err
+			}
+		}
+	}
+	if head != p.freeId {
+		return p.updateFreeId(head)
+	}
+	return nil
+}
+
+// relocateNode
+// Copies node to free slot, which is not in chain of free ids, and points its parent to the copy.
+// Old slot is marked as free only after that, so tree never references free slot.
+func (p *PersistentStorage[K, V]) relocateNode(id, target uint) error {
+	parent, position, err := p.findParent(id)
+	if err != nil {
+		return err
+	}
+	var node = make([]byte, p.nodeSize)
+	if err := p.readAt(node, p.idToOffset(id)); err != nil {
+		return err
+	}
+	if err := p.writeAt(node, p.idToOffset(target)); err != nil {
+		return err
+	}
+	parent.children[position] = target
+	if err := p.persistWithoutValues(parent); err != nil {
+		return err
+	}
+	return p.writeAt(boolSerializer.Serialize(false), p.idToOffset(id))
+}
+
+// findParent
+// Finds parent of node in use by searching for its first key from root. Returns parent and position of node
+// among its children.
+func (p *PersistentStorage[K, V]) findParent(id uint) (Node[K, V], int, error) {
+	node, err := p.Get(id)
+	if err != nil {
+		return Node[K, V]{}, 0, err
+	}
+	if len(node.values) == 0 {
+		return Node[K, V]{}, 0, fmt.Errorf("node %d in use is not part of the tree", id)
+	}
+	key := node.values[0].First
+	current, err := p.GetRoot()
+	if err != nil {
+		return Node[K, V]{}, 0, err
+	}
+	for !current.leaf {
+		_, position, _ := current.values.find(key)
+		if current.children[position] == id {
+			return current, position, nil
+		}
+		if current, err = p.Get(current.children[position]); err != nil {
+			return Node[K, V]{}, 0, err
+		}
+	}
+	return Node[K, V]{}, 0, fmt.Errorf("node %d in use is not part of the tree", id)
+}
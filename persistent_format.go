@@ -0,0 +1,132 @@
+package eternal
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+const (
+	// portableVersion is the first version storing ids and tree metadata with fixed width independent of uint size
+	portableVersion version = 4
+	// countsVersion is the first version storing counts of values in subtrees of children, see Tree.Rank
+	countsVersion version = 5
+)
+
+var (
+	id32Serializer = encoding.CreateForPrimitive[uint32]()
+	id64Serializer = encoding.CreateForPrimitive[uint64]()
+)
+
+// idCodec
+// Encodes node ids and tree metadata. Files of portableVersion and newer always use 64 bits, older files use uint of
+// system which created them.
+type idCodec struct {
+	wide bool // 64 bits instead of 32 bits
+}
+
+// idCodecFor
+// Returns codec of ids used by data file of given version created on system with given uint size.
+func idCodecFor(version version, system byte) (idCodec, error) {
+	if version >= portableVersion {
+		return idCodec{wide: true}, nil
+	}
+	switch system {
+	case 32:
+		return idCodec{wide: false}, nil
+	case 64:
+		return idCodec{wide: true}, nil
+	default:
+		return idCodec{}, fmt.Errorf("data file was created with unsupported %d bits uint", system)
+	}
+}
+
+func (c idCodec) Size() uint {
+	if c.wide {
+		return id64Serializer.Size()
+	}
+	return id32Serializer.Size()
+}
+
+func (c idCodec) Serialize(id uint) []byte {
+	if c.wide {
+		return id64Serializer.Serialize(uint64(id))
+	}
+	// files with 32 bits ids cannot grow over 2^32 nodes, so id always fits
+	return id32Serializer.Serialize(uint32(id))
+}
+
+func (c idCodec) Deserialize(data []byte) uint {
+	if !c.wide {
+		return uint(id32Serializer.Deserialize(data))
+	}
+	id := id64Serializer.Deserialize(data)
+	if bits.UintSize == 32 && id > math.MaxUint32 {
+		// such id cannot address node on current system, max uint is never valid id
+		return math.MaxUint
+	}
+	return uint(id)
+}
+
+// childrenCodec
+// Encodes children of node as number of children followed by b ids, the same way as slice serializer. Files
+// of countsVersion and newer follow them by counts of values in subtrees of children encoded the same way.
+type childrenCodec struct {
+	ids    idCodec
+	b      uint
+	counts bool
+}
+
+func (c childrenCodec) Size() uint {
+	size := lengthSerializer.Size() + c.b*c.ids.Size()
+	if c.counts {
+		size += lengthSerializer.Size() + c.b*id64Serializer.Size()
+	}
+	return size
+}
+
+func (c childrenCodec) Serialize(children, counts []uint) []byte {
+	data := make([]byte, 0, c.Size())
+	data = append(data, lengthSerializer.Serialize(uint32(len(children)))...)
+	for _, child := range children {
+		data = append(data, c.ids.Serialize(child)...)
+	}
+	data = append(data, make([]byte, int((c.b-uint(len(children)))*c.ids.Size()))...)
+	if c.counts {
+		data = append(data, lengthSerializer.Serialize(uint32(len(counts)))...)
+		for _, count := range counts {
+			data = append(data, id64Serializer.Serialize(uint64(count))...)
+		}
+	}
+	return append(data, make([]byte, int(c.Size())-len(data))...)
+}
+
+// Deserialize
+// Returns children and counts of values in their subtrees, counts are nil if they are not stored.
+func (c childrenCodec) Deserialize(data []byte) ([]uint, []uint) {
+	count := min(uint(lengthSerializer.Deserialize(data)), c.b)
+	if count == 0 {
+		return nil, nil
+	}
+	children := make([]uint, count)
+	data = data[lengthSerializer.Size():]
+	for i := range children {
+		children[i] = c.ids.Deserialize(data[uint(i)*c.ids.Size():])
+	}
+	if !c.counts {
+		return children, nil
+	}
+	data = data[c.b*c.ids.Size():]
+	if uint(lengthSerializer.Deserialize(data)) != count {
+		// counts were not maintained for this node
+		return children, nil
+	}
+	counts := make([]uint, count)
+	data = data[lengthSerializer.Size():]
+	for i := range counts {
+		counts[i] = uint(id64Serializer.Deserialize(data[uint(i)*id64Serializer.Size():]))
+	}
+	return children, counts
+}
@@ -0,0 +1,131 @@
+package eternal
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+// ReadSchema
+// Returns schema of keys and values stored in data file as encoding.Tuple.
+func ReadSchema(file File) (encoding.Schema, error) {
+	_, schema, _, err := readStoredSchema(file)
+	return schema, err
+}
+
+// Inspector
+// Reads data file without Go types of its keys and values, see encoding.Decoder for representation of values.
+// Files with values in overflow pages cannot be inspected.
+type Inspector struct {
+	schema  encoding.Schema
+	a, b    uint
+	storage *PersistentStorage[int, encoding.Tuple[any, any]]
+}
+
+// Inspect
+// Opens data file for reading by schema stored in it. File must not be modified while inspector is used.
+func Inspect(file File) (*Inspector, error) {
+	stored, schema, baseNodeAddress, err := readStoredSchema(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := encoding.CreateDecoder(schema)
+	if err != nil {
+		return nil, fmt.Errorf("values of data file cannot be decoded: %w", err)
+	}
+	a, b := uint(stored.A), uint(stored.B)
+	storage, err := newPersistentStorage[int, encoding.Tuple[any, any]](a, b, max(1, stored.BlockSize), file,
+		dynamicValues{b: b, decoder: decoder})
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.setLayout(stored); err != nil {
+		return nil, err
+	}
+	storage.baseNodeAddress = baseNodeAddress
+	if err := storage.loadMetadata(); err != nil {
+		return nil, err
+	}
+	return &Inspector{schema: schema, a: a, b: b, storage: storage}, nil
+}
+
+// Schema
+// Returns schema of stored keys and values as encoding.Tuple.
+func (i *Inspector) Schema() encoding.Schema {
+	return i.schema
+}
+
+// All
+// Returns iterator over all stored keys and values in ascending key order. See Tree.Range for error handling.
+func (i *Inspector) All() (iter.Seq2[any, any], func() error) {
+	tree, err := NewTree[int, encoding.Tuple[any, any]](i.a, i.b, i.storage)
+	if err != nil {
+		return func(func(any, any) bool) {}, func() error { return err }
+	}
+	all, finish := tree.All()
+	return func(yield func(any, any) bool) {
+		for _, entry := range all {
+			if !yield(entry.First, entry.Second) {
+				return
+			}
+		}
+	}, finish
+}
+
+// dynamicValues
+// Decodes entries of node by encoding.Decoder. Keys of decoded values are positions of entries in node and decoded
+// key and value are stored in value, so tree can be walked without comparing keys. Storage using it is read only.
+type dynamicValues struct {
+	b       uint
+	decoder encoding.Decoder
+}
+
+func (d dynamicValues) size() uint {
+	return lengthSerializer.Size() + (d.b-1)*d.decoder.Schema().Size()
+}
+
+func (d dynamicValues) signature() signature {
+	return signature{}
+}
+
+func (d dynamicValues) schema() encoding.Schema {
+	return d.decoder.Schema()
+}
+
+func (d dynamicValues) check(encoding.Tuple[int, encoding.Tuple[any, any]]) error {
+	return nil
+}
+
+func (d dynamicValues) encode(*PersistentStorage[int, encoding.Tuple[any, any]], uint,
+	values[int, encoding.Tuple[any, any]]) ([]byte, []uint, error) {
+	return nil, nil, errors.New("inspected storage is read only")
+}
+
+func (d dynamicValues) decode(_ *PersistentStorage[int, encoding.Tuple[any, any]], data []byte) (
+	values[int, encoding.Tuple[any, any]], error,
+) {
+	count := lengthSerializer.Deserialize(data)
+	if uint(count) > d.b-1 {
+		return nil, fmt.Errorf("node contains %d values, at most %d expected", count, d.b-1)
+	}
+	entrySize := d.decoder.Schema().Size()
+	decoded := make(values[int, encoding.Tuple[any, any]], count)
+	for i := range decoded {
+		entry, err := d.decoder.Decode(data[lengthSerializer.Size()+uint(i)*entrySize:])
+		if err != nil {
+			return nil, err
+		}
+		fields := entry.(map[string]any)
+		decoded[i] = encoding.Tuple[int, encoding.Tuple[any, any]]{
+			First:  i,
+			Second: encoding.Tuple[any, any]{First: fields["First"], Second: fields["Second"]},
+		}
+	}
+	return decoded, nil
+}
+
+func (d dynamicValues) pages(*PersistentStorage[int, encoding.Tuple[any, any]], uint) ([]uint, error) {
+	return nil, nil
+}
@@ -0,0 +1,189 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+// Migrate
+// Copies tree stored in src to empty file dst converting keys and values from the schema stored in src to the schema
+// of given serializers (see encoding.CreateMigration for supported changes). Parameters a, b and block size are taken
+// from src, options are applied to the new storage. src is only read. Files older than version 3 do not store their
+// schema, they are only converted to the current format and must be read with serializers they were created with.
+func Migrate[K cmp.Ordered, V any](
+	src, dst File, keySerializer encoding.Serializer[K], valueSerializer encoding.Serializer[V],
+	options ...StorageOption,
+) (*PersistentStorage[K, V], error) {
+	old, err := openMigratedStorage(src, keySerializer, valueSerializer)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := NewPersistentStorage[K, V](old.a, old.b, old.blockSize, dst, keySerializer, valueSerializer,
+		options...)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := NewTree[K, V](old.a, old.b, old.storage)
+	if err != nil {
+		return nil, err
+	}
+	all, finish := tree.All()
+	if _, err := BulkLoad(old.a, old.b, rebuildFillFactor, storage, all); err != nil {
+		return nil, fmt.Errorf("could not store migrated values: %w", err)
+	}
+	if err := finish(); err != nil {
+		return nil, fmt.Errorf("could not read values from data file: %w", err)
+	}
+	return storage, nil
+}
+
+// MigrateInPlace
+// Converts data file the same way as Migrate, but rewrites the file itself. All values are loaded to memory,
+// then the file is truncated and the tree is rebuilt. Crash during rebuilding loses data, so Migrate to new file
+// should be preferred, when there is enough space for both files.
+func MigrateInPlace[K cmp.Ordered, V any](
+	file File, keySerializer encoding.Serializer[K], valueSerializer encoding.Serializer[V],
+	options ...StorageOption,
+) (*PersistentStorage[K, V], error) {
+	old, err := openMigratedStorage(file, keySerializer, valueSerializer)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := NewTree[K, V](old.a, old.b, old.storage)
+	if err != nil {
+		return nil, err
+	}
+	var migrated []encoding.Tuple[K, V]
+	all, finish := tree.All()
+	for key, value := range all {
+		migrated = append(migrated, encoding.Tuple[K, V]{First: key, Second: value})
+	}
+	if err := finish(); err != nil {
+		return nil, fmt.Errorf("could not read values from data file: %w", err)
+	}
+	if err := file.Truncate(0); err != nil {
+		return nil, err
+	}
+	storage, err := NewPersistentStorage[K, V](old.a, old.b, old.blockSize, file, keySerializer, valueSerializer,
+		options...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = BulkLoad(old.a, old.b, rebuildFillFactor, storage, func(yield func(K, V) bool) {
+		for _, value := range migrated {
+			if !yield(value.First, value.Second) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not store migrated values: %w", err)
+	}
+	return storage, nil
+}
+
+type migratedStorage[K cmp.Ordered, V any] struct {
+	storage   *PersistentStorage[K, V]
+	a, b      uint
+	blockSize int64
+}
+
+// openMigratedStorage
+// Opens data file for reading with values converted by migration from the schema stored in the file.
+func openMigratedStorage[K cmp.Ordered, V any](
+	file File, keySerializer encoding.Serializer[K], valueSerializer encoding.Serializer[V],
+) (*migratedStorage[K, V], error) {
+	stored, err := readStoredHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	a, b := uint(stored.A), uint(stored.B)
+	values, err := newInlineValues(b, keySerializer, valueSerializer)
+	if err != nil {
+		return nil, err
+	}
+	var from encoding.Schema
+	var baseNodeAddress int64
+	if stored.Version < schemaVersion {
+		// file without schema can be only read by serializers it was created with
+		if stored.Signature != values.signature() {
+			return nil, fmt.Errorf("data file with version %d does not store its schema: %w", stored.Version,
+				ErrSchemaMismatch)
+		}
+		from = values.schema()
+		if _, baseNodeAddress, err = readSchemaSection(file, stored); err != nil {
+			return nil, err
+		}
+	} else if from, baseNodeAddress, err = parseSchemaSection(file, stored); err != nil {
+		return nil, err
+	}
+	migration, err := encoding.CreateMigration(from, values.schema())
+	if err != nil {
+		return nil, err
+	}
+	storage, err := newPersistentStorage[K, V](a, b, max(1, stored.BlockSize), file, migratedValues[K, V]{
+		b:         b,
+		migration: migration,
+		values:    values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.setLayout(stored); err != nil {
+		return nil, err
+	}
+	storage.baseNodeAddress = baseNodeAddress
+	if err := storage.loadMetadata(); err != nil {
+		return nil, err
+	}
+	return &migratedStorage[K, V]{storage: storage, a: a, b: b, blockSize: stored.BlockSize}, nil
+}
+
+// migratedValues
+// Reads values stored with the old schema and converts them to the current one. Storage using it is read only.
+type migratedValues[K cmp.Ordered, V any] struct {
+	b         uint
+	migration encoding.Migration
+	values    inlineValues[K, V]
+}
+
+func (m migratedValues[K, V]) size() uint {
+	return lengthSerializer.Size() + uint(m.b-1)*m.migration.From().Size()
+}
+
+func (m migratedValues[K, V]) signature() signature {
+	return m.values.signature()
+}
+
+func (m migratedValues[K, V]) schema() encoding.Schema {
+	return m.migration.From()
+}
+
+func (m migratedValues[K, V]) check(encoding.Tuple[K, V]) error {
+	return nil
+}
+
+func (m migratedValues[K, V]) encode(*PersistentStorage[K, V], uint, values[K, V]) ([]byte, []uint, error) {
+	return nil, nil, errors.New("migrated storage is read only")
+}
+
+func (m migratedValues[K, V]) decode(_ *PersistentStorage[K, V], data []byte) (values[K, V], error) {
+	count := lengthSerializer.Deserialize(data)
+	if uint(count) > m.b-1 {
+		return nil, fmt.Errorf("node contains %d values, at most %d expected", count, m.b-1)
+	}
+	entrySize := m.migration.From().Size()
+	decoded := make(values[K, V], count)
+	for i := range decoded {
+		entry := m.migration.Convert(data[lengthSerializer.Size()+uint(i)*entrySize:])
+		decoded[i] = m.values.tupleSerializer.Deserialize(entry)
+	}
+	return decoded, nil
+}
+
+func (m migratedValues[K, V]) pages(*PersistentStorage[K, V], uint) ([]uint, error) {
+	return nil, nil
+}
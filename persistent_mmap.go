@@ -0,0 +1,121 @@
+package eternal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrMemoryMapUnsupported is returned when storage is created WithMemoryMap on platform without memory mapping
+var ErrMemoryMapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// WithMemoryMap
+// Serves reads of nodes from data file mapped to memory instead of read syscall per node. Writes still go through
+// the file and the mapping grows with the file. Data file must not be truncated by anyone else while it is mapped.
+// Memory mapping is supported only for OSFile on Linux, otherwise storage creation fails with ErrMemoryMapUnsupported.
+func WithMemoryMap() StorageOption {
+	return func(options *storageOptions) {
+		options.memoryMap = true
+	}
+}
+
+// memoryMap
+// Read only shared mapping of data file. Mapped region may exceed the file, only its first size bytes are read.
+type memoryMap struct {
+	lock sync.RWMutex
+	file File
+	fd   uintptr
+	data []byte // mapped region
+	size int64  // size of file known to be covered by mapped region
+}
+
+func newMemoryMap(file File) (*memoryMap, error) {
+	if !memoryMapSupported {
+		return nil, ErrMemoryMapUnsupported
+	}
+	descriptor, ok := file.(interface{ Fd() uintptr })
+	if !ok {
+		return nil, fmt.Errorf("%w: file has no descriptor", ErrMemoryMapUnsupported)
+	}
+	// file is mapped with first read, new file is empty and empty file cannot be mapped
+	return &memoryMap{file: file, fd: descriptor.Fd()}, nil
+}
+
+// ReadAt
+// Reads from mapped region, it is remapped when read exceeds known size of the file.
+func (m *memoryMap) ReadAt(data []byte, offset int64) (int, error) {
+	end := offset + int64(len(data))
+	m.lock.RLock()
+	if end > m.size {
+		m.lock.RUnlock()
+		if err := m.grow(end); err != nil {
+			return 0, err
+		}
+		m.lock.RLock()
+	}
+	defer m.lock.RUnlock()
+	if offset >= m.size {
+		return 0, io.EOF
+	}
+	read := copy(data, m.data[offset:min(end, m.size)])
+	if read < len(data) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// grow
+// Refreshes known size of the file and maps it whole, if it exceeds mapped region.
+func (m *memoryMap) grow(end int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if end <= m.size {
+		// mapping was grown by another reader
+		return nil
+	}
+	size, err := m.file.Size()
+	if err != nil {
+		return err
+	}
+	if size > int64(len(m.data)) {
+		// region is doubled, so growing file is not remapped with every new node
+		capacity := max(size, 2*int64(len(m.data)))
+		pageSize := int64(os.Getpagesize())
+		capacity = (capacity + pageSize - 1) / pageSize * pageSize
+		data, err := mapFile(m.fd, capacity)
+		if err != nil {
+			return err
+		}
+		if err := m.unmap(); err != nil {
+			return errors.Join(err, unmapFile(data))
+		}
+		m.data = data
+	}
+	m.size = size
+	return nil
+}
+
+// truncate
+// Must be called before the file is truncated, so truncated part is never read.
+func (m *memoryMap) truncate(size int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.size = min(m.size, size)
+}
+
+func (m *memoryMap) unmap() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data, m.size = nil, 0
+	return unmapFile(data)
+}
+
+func (m *memoryMap) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.unmap()
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package eternal
+
+import (
+	"errors"
+	"math"
+	"syscall"
+)
+
+const memoryMapSupported = true
+
+func mapFile(fd uintptr, capacity int64) ([]byte, error) {
+	if capacity > math.MaxInt {
+		return nil, errors.New("data file is too large to be mapped")
+	}
+	return syscall.Mmap(int(fd), 0, int(capacity), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
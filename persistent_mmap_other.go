@@ -0,0 +1,13 @@
+//go:build !linux
+
+package eternal
+
+const memoryMapSupported = false
+
+func mapFile(uintptr, int64) ([]byte, error) {
+	return nil, ErrMemoryMapUnsupported
+}
+
+func unmapFile([]byte) error {
+	return ErrMemoryMapUnsupported
+}
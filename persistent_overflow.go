@@ -0,0 +1,452 @@
+package eternal
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+// overflowPageHeader
+// Stored after page marker and checksum of page.
+type overflowPageHeader struct {
+	Next   uint64 // id of the following page, noFreeId for the last page
+	Length uint32
+}
+
+var overflowPageHeaderSerializer encoding.Serializer[overflowPageHeader]
+
+func init() {
+	var err error
+	overflowPageHeaderSerializer, err = encoding.Create[overflowPageHeader]()
+	if err != nil {
+		panic(fmt.Errorf("could not create serializer for overflow page header: %w", err))
+	}
+}
+
+// overflowReference
+// Value shorter than inline size is stored directly in node, longer value is stored in chain of overflow pages
+// starting with page with id Second. Root id is never used by page, so zero means value is inline.
+type overflowReference = encoding.Tuple[[]byte, uint64]
+
+// ErrOverflowUnsupported is returned by operations which cannot handle storage with overflow pages
+var ErrOverflowUnsupported = errors.New("storage with overflow pages is not supported")
+
+// NewPersistentStorageWithOverflow
+// Creates persistent storage (see NewPersistentStorage) for values of variable length. Encoded values up to inlineSize
+// bytes are stored directly in node, longer values are stored in chain of overflow pages which occupy the same slots
+// as nodes. Every tuple slot reserves only inlineSize bytes for value.
+// Defragment, DefragmentStep and Recover do not support storage with overflow pages, they fail with
+// ErrOverflowUnsupported. Reorganize moves pages as well, so it can compact the file.
+func NewPersistentStorageWithOverflow[K cmp.Ordered, V any](
+	a, b uint, blockSize int64, file File, keySerializer encoding.Serializer[K],
+	valueSerializer encoding.VariableSerializer[V], inlineSize uint32, options ...StorageOption,
+) (
+	*PersistentStorage[K, V], error,
+) {
+	if inlineSize == 0 {
+		return nil, errors.New("inline size must be at least one byte")
+	}
+	inlineSerializer, err := encoding.CreateForSlice[[]byte](inlineSize)
+	if err != nil {
+		return nil, err
+	}
+	referenceSerializer := encoding.CreateForTuple(inlineSerializer, id64Serializer)
+	entriesSerializer, err := encoding.CreateSliceForSerializer(
+		encoding.CreateForTuple(keySerializer, referenceSerializer), uint32(b-1))
+	if err != nil {
+		return nil, fmt.Errorf("could not create serializer for encoding of values: %w", err)
+	}
+	values := overflowValues[K, V]{
+		inlineSize:        inlineSize,
+		keySerializer:     keySerializer,
+		valueSerializer:   valueSerializer,
+		entriesSerializer: entriesSerializer,
+	}
+	storage, err := openPersistentStorage[K, V](a, b, max(1, blockSize), file, values, options...)
+	if err != nil {
+		return storage, err
+	}
+	if storage.pageCapacity() <= 0 {
+		return nil, errors.New("node slot is too small to hold overflow page")
+	}
+	storage.chains = newChainCache()
+	return storage, nil
+}
+
+// overflowValues
+// Stores values of variable length, long values are moved to overflow pages.
+// Pages are not shared, persist of node keeps pages of unchanged values, writes changed values to new pages and
+// releases previous ones.
+type overflowValues[K cmp.Ordered, V any] struct {
+	inlineSize        uint32
+	keySerializer     encoding.Serializer[K]
+	valueSerializer   encoding.VariableSerializer[V]
+	entriesSerializer encoding.Serializer[[]encoding.Tuple[K, overflowReference]]
+}
+
+func (o overflowValues[K, V]) size() uint {
+	return o.entriesSerializer.Size()
+}
+
+func (o overflowValues[K, V]) signature() signature {
+	entriesSignature := o.entriesSerializer.Signature()
+	valueSignature := o.valueSerializer.Signature()
+	return sha512.Sum512(append(entriesSignature[:], valueSignature[:]...))
+}
+
+func (o overflowValues[K, V]) schema() encoding.Schema {
+	return encoding.TupleSchema(o.keySerializer.Schema(), o.valueSerializer.Schema())
+}
+
+func (o overflowValues[K, V]) check(value encoding.Tuple[K, V]) error {
+	// values have variable length, only key can be truncated
+	err := o.keySerializer.Check(value.First)
+	var tooLarge *encoding.ValueTooLargeError
+	if errors.As(err, &tooLarge) {
+		// path is relative to tuple of key and value as for inline values
+		tooLarge.Path = strings.TrimSuffix("First."+tooLarge.Path, ".")
+	}
+	return err
+}
+
+func (o overflowValues[K, V]) encode(p *PersistentStorage[K, V], id uint, values values[K, V]) (
+	[]byte, []uint, error,
+) {
+	previous, err := o.references(p, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	reusable := make(map[K]uint, len(previous))
+	for _, reference := range previous {
+		reusable[reference.First] = reference.Second
+	}
+	entries := make([]encoding.Tuple[K, overflowReference], len(values))
+	for i, value := range values {
+		if !p.truncate {
+			if err := o.check(value); err != nil {
+				return nil, nil, err
+			}
+		}
+		data := o.valueSerializer.Serialize(value.Second)
+		entries[i].First = value.First
+		if len(data) <= int(o.inlineSize) {
+			entries[i].Second.First = data
+			continue
+		}
+		if page, found := reusable[value.First]; found {
+			unchanged, err := p.chainHolds(page, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if unchanged {
+				entries[i].Second.Second = uint64(page)
+				delete(reusable, value.First)
+				continue
+			}
+		}
+		page, err := p.writePages(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[i].Second.Second = uint64(page)
+	}
+	var released []uint
+	for _, reference := range previous {
+		if page, found := reusable[reference.First]; found && page == reference.Second {
+			released = append(released, page)
+		}
+	}
+	return o.entriesSerializer.Serialize(entries), released, nil
+}
+
+func (o overflowValues[K, V]) decode(p *PersistentStorage[K, V], data []byte) (values[K, V], error) {
+	entries := o.entriesSerializer.Deserialize(data)
+	decoded := make(values[K, V], len(entries))
+	for i, entry := range entries {
+		valueData := entry.Second.First
+		if entry.Second.Second != noFreeId {
+			var err error
+			valueData, err = p.readPages(uint(entry.Second.Second))
+			if err != nil {
+				return nil, err
+			}
+		}
+		value, err := o.valueSerializer.Deserialize(valueData)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode value stored under key %v: %w", entry.First, err)
+		}
+		decoded[i] = encoding.Tuple[K, V]{First: entry.First, Second: value}
+	}
+	return decoded, nil
+}
+
+func (o overflowValues[K, V]) pages(p *PersistentStorage[K, V], id uint) ([]uint, error) {
+	references, err := o.references(p, id)
+	if err != nil {
+		return nil, err
+	}
+	var pages []uint
+	for _, reference := range references {
+		pages = append(pages, reference.Second)
+	}
+	return pages, nil
+}
+
+// references
+// Returns keys of values stored in page chains by node in slot with given id, together with first ids of the chains.
+// Slot without node has no references, pages of corrupted node cannot be found, so error is returned for it.
+func (o overflowValues[K, V]) references(p *PersistentStorage[K, V], id uint) ([]encoding.Tuple[K, uint], error) {
+	payload, err := p.readPayload(id)
+	if err != nil {
+		if !errors.Is(err, errOverflowPage) && (errors.Is(err, io.EOF) || errors.Is(err, ErrMissingNode)) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var references []encoding.Tuple[K, uint]
+	for _, entry := range o.entriesSerializer.Deserialize(payload) {
+		if entry.Second.Second != noFreeId {
+			references = append(references, encoding.Tuple[K, uint]{First: entry.First, Second: uint(entry.Second.Second)})
+		}
+	}
+	return references, nil
+}
+
+// remapReferences
+// Replaces ids of pages referenced by encoded values with ids given by newIds.
+func (o overflowValues[K, V]) remapReferences(encoded []byte, newIds map[uint]uint) {
+	entries := o.entriesSerializer.Deserialize(encoded)
+	for i, entry := range entries {
+		if entry.Second.Second != noFreeId {
+			entries[i].Second.Second = uint64(newIds[uint(entry.Second.Second)])
+		}
+	}
+	copy(encoded, o.entriesSerializer.Serialize(entries))
+}
+
+// pageCapacity
+// Returns number of value bytes which fit to one overflow page.
+func (p *PersistentStorage[K, V]) pageCapacity() int64 {
+	return p.paddedNodeSize - int64(boolSerializer.Size()+checksumSerializer.Size()+
+		overflowPageHeaderSerializer.Size())
+}
+
+// writePages
+// Stores data to chain of newly allocated pages and returns id of the first one.
+func (p *PersistentStorage[K, V]) writePages(data []byte) (uint, error) {
+	capacity := int(p.pageCapacity())
+	ids := make([]uint, 0, (len(data)+capacity-1)/capacity)
+	for range cap(ids) {
+		id, err := p.NewId()
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	for i, id := range ids {
+		chunk := data[i*capacity : min(len(data), (i+1)*capacity)]
+		header := overflowPageHeader{Next: noFreeId, Length: uint32(len(chunk))}
+		if i+1 < len(ids) {
+			header.Next = uint64(ids[i+1])
+		}
+		if err := p.writePage(id, header, chunk); err != nil {
+			return 0, err
+		}
+	}
+	p.chains.put(ids[0], data)
+	return ids[0], nil
+}
+
+// writePage
+// Writes page with given header and data together with their checksum.
+func (p *PersistentStorage[K, V]) writePage(id uint, header overflowPageHeader, chunk []byte) error {
+	content := append(overflowPageHeaderSerializer.Serialize(header), chunk...)
+	page := make([]byte, 0, p.paddedNodeSize)
+	page = append(page, pageMarker)
+	page = append(page, checksumSerializer.Serialize(crc32.Checksum(content, crcTable))...)
+	page = append(page, content...)
+	return p.writeAt(page, p.idToOffset(id))
+}
+
+// readPage
+// Reads page and verifies its checksum. Returns header of page and its data.
+func (p *PersistentStorage[K, V]) readPage(id uint) (overflowPageHeader, []byte, error) {
+	page := make([]byte, p.paddedNodeSize)
+	if err := p.readAt(page, p.idToOffset(id)); err != nil {
+		return overflowPageHeader{}, nil, err
+	}
+	if page[0] != pageMarker {
+		return overflowPageHeader{}, nil, &CorruptedNodeError{Id: id}
+	}
+	checksum := checksumSerializer.Deserialize(page[boolSerializer.Size():])
+	content := page[boolSerializer.Size()+checksumSerializer.Size():]
+	header := overflowPageHeaderSerializer.Deserialize(content)
+	end := int64(overflowPageHeaderSerializer.Size()) + int64(header.Length)
+	if end > int64(len(content)) || crc32.Checksum(content[:end], crcTable) != checksum {
+		return overflowPageHeader{}, nil, &CorruptedNodeError{Id: id}
+	}
+	return header, content[overflowPageHeaderSerializer.Size():end], nil
+}
+
+// readPages
+// Reads data stored in chain of pages starting with given id. Returned data must not be modified, they can be shared
+// with cache of chains.
+func (p *PersistentStorage[K, V]) readPages(id uint) ([]byte, error) {
+	if data, found := p.chains.get(id); found {
+		return data, nil
+	}
+	var data []byte
+	if err := p.walkChain(id, func(_ uint, chunk []byte) {
+		data = append(data, chunk...)
+	}); err != nil {
+		return nil, err
+	}
+	p.chains.put(id, data)
+	return data, nil
+}
+
+// walkChain
+// Visits pages of chain starting with given id in order, cycle is reported as corrupted page.
+func (p *PersistentStorage[K, V]) walkChain(id uint, visit func(id uint, chunk []byte)) error {
+	visited := make(map[uint]struct{})
+	for id != noFreeId {
+		if _, found := visited[id]; found {
+			return &CorruptedNodeError{Id: id}
+		}
+		visited[id] = struct{}{}
+		header, chunk, err := p.readPage(id)
+		if err != nil {
+			return err
+		}
+		visit(id, chunk)
+		id = uint(header.Next)
+	}
+	return nil
+}
+
+// chainHolds
+// Reports if chain of pages starting with given id holds exactly given data. Corrupted chain holds nothing.
+func (p *PersistentStorage[K, V]) chainHolds(id uint, data []byte) (bool, error) {
+	stored, err := p.readPages(id)
+	if err != nil {
+		if errors.Is(err, ErrCorruptedNode) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(stored, data), nil
+}
+
+// freePages
+// Returns chains of pages starting with given ids to free ids.
+func (p *PersistentStorage[K, V]) freePages(chains []uint) error {
+	for _, id := range chains {
+		if err := p.freeChain(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PersistentStorage[K, V]) freeChain(id uint) error {
+	p.chains.drop(id)
+	for id != noFreeId {
+		header, _, err := p.readPage(id)
+		if err != nil {
+			if errors.Is(err, ErrCorruptedNode) {
+				// rest of the chain cannot be followed, it is lost
+				return nil
+			}
+			return err
+		}
+		if err := p.free(id); err != nil {
+			return err
+		}
+		id = uint(header.Next)
+	}
+	return nil
+}
+
+// chainCacheSize
+// Maximal number of bytes of chain data held by chainCache.
+const chainCacheSize = 1 << 20
+
+// chainCache
+// Holds data of page chains by id of their first page, so unchanged long values are neither read again when their
+// node is loaded nor written again when it is persisted. Cache is emptied whenever it would exceed chainCacheSize.
+// Nil cache holds nothing.
+type chainCache struct {
+	lock   sync.Mutex
+	chains map[uint][]byte
+	size   int
+}
+
+func newChainCache() *chainCache {
+	return &chainCache{chains: make(map[uint][]byte)}
+}
+
+func (c *chainCache) get(id uint) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, found := c.chains[id]
+	return data, found
+}
+
+func (c *chainCache) put(id uint, data []byte) {
+	if c == nil || len(data) > chainCacheSize {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size -= len(c.chains[id])
+	if c.size+len(data) > chainCacheSize {
+		clear(c.chains)
+		c.size = 0
+	}
+	c.chains[id] = data
+	c.size += len(data)
+}
+
+func (c *chainCache) drop(id uint) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size -= len(c.chains[id])
+	delete(c.chains, id)
+}
+
+// clear
+// Drops all chains, it must be called whenever pages are changed other way than by writePages and freeChain.
+func (c *chainCache) clear() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	clear(c.chains)
+	c.size = 0
+}
+
+// overflowSchema
+// Reports if stored schema describes values of variable length, which are stored in overflow pages.
+func overflowSchema(description string) bool {
+	schema, err := encoding.ParseSchema(description)
+	if err != nil {
+		return false
+	}
+	_, err = encoding.CreateDecoder(schema)
+	return err != nil
+}
@@ -0,0 +1,107 @@
+package eternal
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+// FileInfo
+// Description of data file returned by Probe.
+type FileInfo struct {
+	// Valid reports if file starts with eternal identifier, other fields are filled only for valid files
+	Valid     bool
+	Version   uint16
+	BlockSize int64
+	A, B      uint
+	// SystemBits is size of uint of system which created file, ids in files older than version 4 depend on it
+	SystemBits uint8
+	// Depth is depth of stored tree, it is zero for files of unsupported version
+	Depth uint
+	// Slots is number of node slots (nodes in use, free nodes and overflow pages), it is valid only if SlotsKnown
+	// is set. Size of node cannot be determined from files without schema (older than version 3) or with values
+	// in overflow pages, as their layout depends on types known only to application.
+	Slots      uint
+	SlotsKnown bool
+}
+
+// Probe
+// Detects if data is eternal data file and describes it. Data which is not eternal data file is reported by
+// FileInfo.Valid, error is returned only when data cannot be read.
+func Probe(data io.ReaderAt) (FileInfo, error) {
+	stored, err := readHeader(data)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// file is shorter than header
+		return FileInfo{}, nil
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if stored.Identifier != eternalIdentifier {
+		return FileInfo{}, nil
+	}
+	info := FileInfo{
+		Valid:      true,
+		Version:    stored.Version,
+		BlockSize:  stored.BlockSize,
+		A:          uint(stored.A),
+		B:          uint(stored.B),
+		SystemBits: stored.System,
+	}
+	ids, err := idCodecFor(stored.Version, stored.System)
+	if err != nil || stored.Version == 0 || stored.Version > currentVersion || stored.B < 2 {
+		// layout of file is unknown
+		return info, nil
+	}
+	metaBytes := make([]byte, ids.Size())
+	if _, err := data.ReadAt(metaBytes, int64(headerSerializer.Size())); err != nil {
+		return info, err
+	}
+	info.Depth = ids.Deserialize(metaBytes)
+	info.Slots, info.SlotsKnown, err = probeSlots(data, stored, ids)
+	return info, err
+}
+
+// probeSlots
+// Counts node slots of file with inline values. Size of node is computed from stored schema and verified by checksum
+// of root, false is returned when number of slots cannot be determined.
+func probeSlots(data io.ReaderAt, stored header, ids idCodec) (uint, bool, error) {
+	if stored.Version < schemaVersion {
+		return 0, false, nil
+	}
+	description, baseNodeAddress, err := readSchemaSection(data, stored)
+	if err != nil {
+		return 0, false, err
+	}
+	schema, err := encoding.ParseSchema(description)
+	if err != nil || overflowSchema(description) {
+		// values of variable length are stored in overflow pages, size of their inline part is not stored
+		return 0, false, nil
+	}
+	b := uint(stored.B)
+	valuesSize := lengthSerializer.Size() + (b-1)*schema.Size()
+	children := childrenCodec{ids: ids, b: b, counts: stored.Version >= countsVersion}
+	payloadSize := valuesSize + children.Size()
+	nodeSize := max(checksumSerializer.Size()+payloadSize, ids.Size()) + boolSerializer.Size()
+	paddedNodeSize := calculatePaddedNodeSize(int64(nodeSize), max(1, stored.BlockSize))
+
+	root := make([]byte, nodeSize)
+	if _, err := data.ReadAt(root, baseNodeAddress); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	payload := root[boolSerializer.Size()+checksumSerializer.Size():][:payloadSize]
+	checksum := checksumSerializer.Deserialize(root[boolSerializer.Size():])
+	if root[0] != nodeMarker || crc32.Checksum(payload, crcTable) != checksum {
+		return 0, false, nil
+	}
+	size, err := readerSize(data)
+	if err != nil {
+		return 0, false, err
+	}
+	return uint((size - baseNodeAddress) / paddedNodeSize), true, nil
+}
@@ -0,0 +1,143 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+// RecoveryReport
+// Summary of Recover.
+type RecoveryReport struct {
+	// Slots is number of node slots found in damaged file
+	Slots int
+	// ReachableNodes is number of nodes which were reachable from root and could be loaded
+	ReachableNodes int
+	// OrphanedNodes is number of nodes in use, which were not reachable from root
+	OrphanedNodes int
+	// CorruptedNodes is number of nodes in use, which do not match their checksum
+	CorruptedNodes int
+	// Values is number of values stored in the rebuilt tree
+	Values int
+}
+
+// Recover
+// Rebuilds damaged data file src into empty file dst. Header and metadata of src are not trusted, all node slots
+// are scanned and values from every node marked as in use and matching its checksum are harvested and bulk loaded.
+// When the same key is found in more nodes, value from node reachable from root wins.
+// File with overflow pages cannot be recovered, ErrOverflowUnsupported is returned for it.
+// Config must be the same as the one src was created with, options are applied to the new storage.
+func Recover[K cmp.Ordered, V any](
+	a, b uint, blockSize int64, src, dst File, keySerializer encoding.Serializer[K],
+	valueSerializer encoding.Serializer[V], options ...StorageOption,
+) (*PersistentStorage[K, V], *RecoveryReport, error) {
+	values, err := newInlineValues(b, keySerializer, valueSerializer)
+	if err != nil {
+		return nil, nil, err
+	}
+	damaged, err := newPersistentStorage[K, V](a, b, max(1, blockSize), src, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stored, err := readHeader(src); err == nil && stored.Identifier == eternalIdentifier {
+		// version and size of schema section are needed to find nodes, if they cannot be read, layout of new file
+		// with current schema is kept
+		if description, baseNodeAddress, err := readSchemaSection(src, stored); err == nil {
+			if overflowSchema(description) {
+				return nil, nil, fmt.Errorf("%w: recovery", ErrOverflowUnsupported)
+			}
+			if err := damaged.setLayout(stored); err != nil {
+				return nil, nil, err
+			}
+			damaged.baseNodeAddress = baseNodeAddress
+		}
+	}
+	report := &RecoveryReport{}
+	harvested, err := damaged.harvest(report)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read damaged file: %w", err)
+	}
+
+	storage, err := NewPersistentStorage[K, V](a, b, blockSize, dst, keySerializer, valueSerializer, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := slices.Sorted(maps.Keys(harvested))
+	_, err = BulkLoad(a, b, rebuildFillFactor, storage, func(yield func(K, V) bool) {
+		for _, key := range keys {
+			if !yield(key, harvested[key]) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not store recovered values: %w", err)
+	}
+	report.Values = len(harvested)
+	return storage, report, nil
+}
+
+// harvest
+// Collects values from nodes reachable from root firstly, then from remaining nodes in use.
+func (p *PersistentStorage[K, V]) harvest(report *RecoveryReport) (map[K]V, error) {
+	size, err := p.size()
+	if err != nil {
+		return nil, err
+	}
+	report.Slots = int(max(0, (size-p.baseNodeAddress)/p.paddedNodeSize))
+	var (
+		harvested = make(map[K]V)
+		reachable = make(map[uint]struct{})
+		toVisit   = []uint{rootId}
+	)
+	for len(toVisit) > 0 {
+		var id uint
+		id, toVisit = popLast(toVisit)
+		if _, visited := reachable[id]; visited || int(id) >= report.Slots {
+			continue
+		}
+		node, err := p.Get(id)
+		if err != nil {
+			if isNodeDamaged(err) {
+				// node will be counted during scan of all slots
+				continue
+			}
+			return nil, err
+		}
+		reachable[id] = struct{}{}
+		report.ReachableNodes++
+		for _, value := range node.values {
+			harvested[value.First] = value.Second
+		}
+		toVisit = append(toVisit, node.children...)
+	}
+
+	for id := uint(0); int(id) < report.Slots; id++ {
+		if _, visited := reachable[id]; visited {
+			continue
+		}
+		node, err := p.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrMissingNode):
+				// slot is free
+			case errors.Is(err, ErrCorruptedNode):
+				report.CorruptedNodes++
+			default:
+				return nil, err
+			}
+			continue
+		}
+		report.OrphanedNodes++
+		for _, value := range node.values {
+			if _, found := harvested[value.First]; !found {
+				harvested[value.First] = value.Second
+			}
+		}
+	}
+	return harvested, nil
+}
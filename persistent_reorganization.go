@@ -0,0 +1,196 @@
+package eternal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// NodeOrder
+// Determines how Reorganize lays out nodes in data file.
+type NodeOrder uint8
+
+const (
+	// BreadthFirst stores nodes level by level from root. Inner nodes are packed at the beginning of file and leaves
+	// follow them in key order, so scans over leaves read file sequentially.
+	BreadthFirst NodeOrder = iota + 1
+	// KeyOrder stores nodes in the order in which ascending range scan visits them (node precedes its subtree and
+	// subtrees are ordered by keys), so every subtree occupies contiguous part of file.
+	KeyOrder
+)
+
+// Reorganize
+// Rewrites data file, so nodes are laid out in given order and there are no free slots. Unlike Defragment, every node
+// can be moved. Overflow pages follow all nodes, chains are stored in order of nodes which reference them.
+// Ids of all nodes and pages are held in memory and every slot is written at most twice.
+// Reorganization changes node ids, so it shouldn't be called in parallel with tree operations, CachedStorage wrapping
+// this storage must be purged before and after it. It is not atomic even with write-ahead log, crash during
+// reorganization corrupts the tree.
+func (p *PersistentStorage[K, V]) Reorganize(order NodeOrder) error {
+	if order != BreadthFirst && order != KeyOrder {
+		return errors.New("unknown order of nodes")
+	}
+	if p.batch != nil {
+		return errors.New("reorganization cannot run during batch")
+	}
+	layout, err := p.nodeLayout(order)
+	if err != nil {
+		return err
+	}
+	overflow, hasOverflow := p.values.(overflowValues[K, V])
+	pages := make(map[uint]struct{})
+	if hasOverflow {
+		pageLayout, err := p.pageLayout(overflow, layout)
+		if err != nil {
+			return err
+		}
+		for _, id := range pageLayout {
+			pages[id] = struct{}{}
+		}
+		layout = append(layout, pageLayout...)
+		// cached chains are stored under ids of their first pages
+		defer p.chains.clear()
+	}
+	var (
+		newIds   = make(map[uint]uint, len(layout))
+		location = make(map[uint]uint, len(layout)) // slot of node which was not placed yet
+		occupant = make(map[uint]uint, len(layout)) // node stored in slot
+	)
+	for newId, id := range layout {
+		newIds[id] = uint(newId)
+		location[id], occupant[id] = id, id
+	}
+	for newId, id := range layout {
+		target, current := uint(newId), location[id]
+		var write func() error
+		if _, page := pages[id]; page {
+			header, chunk, err := p.readPage(current)
+			if err != nil {
+				return err
+			}
+			header.Next = uint64(newIds[uint(header.Next)])
+			write = func() error {
+				return p.writePage(target, header, chunk)
+			}
+		} else {
+			payload, err := p.readPayload(current)
+			if err != nil {
+				return err
+			}
+			children, counts := p.childrenSerializer.Deserialize(payload[p.values.size():])
+			for i, child := range children {
+				children[i] = newIds[child]
+			}
+			copy(payload[p.values.size():], p.childrenSerializer.Serialize(children, counts))
+			if hasOverflow {
+				overflow.remapReferences(payload[:p.values.size()], newIds)
+			}
+			write = func() error {
+				return p.writePayload(target, payload)
+			}
+		}
+		// slots before target already hold placed nodes, so node is never moved to them
+		if current != target {
+			delete(occupant, current)
+			if displaced, found := occupant[target]; found {
+				if err := p.moveSlot(target, current); err != nil {
+					return err
+				}
+				location[displaced], occupant[current] = current, displaced
+			}
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		occupant[target] = id
+		delete(location, id)
+	}
+	if err := p.updateFreeId(noFreeId); err != nil {
+		return err
+	}
+	if p.deferMetadata() {
+		// metadata on disk must not reference truncated slots
+		if err := p.Sync(); err != nil {
+			return err
+		}
+	}
+	return p.truncateFile(p.idToOffset(uint(len(layout))))
+}
+
+// nodeLayout
+// Returns ids of nodes of the tree in given order.
+func (p *PersistentStorage[K, V]) nodeLayout(order NodeOrder) ([]uint, error) {
+	var (
+		layout  []uint
+		seen    = make(map[uint]struct{})
+		pending = []uint{rootId}
+	)
+	for len(pending) > 0 {
+		var id uint
+		if order == BreadthFirst {
+			id, pending = pending[0], pending[1:]
+		} else {
+			id, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		}
+		if _, found := seen[id]; found {
+			return nil, fmt.Errorf("node %d is referenced more than once", id)
+		}
+		seen[id] = struct{}{}
+		node, err := p.loadWithoutValues(id)
+		if err != nil {
+			return nil, err
+		}
+		layout = append(layout, id)
+		if order == BreadthFirst {
+			pending = append(pending, node.children...)
+		} else {
+			// the first child must be on top of stack
+			children := slices.Clone(node.children)
+			slices.Reverse(children)
+			pending = append(pending, children...)
+		}
+	}
+	return layout, nil
+}
+
+// pageLayout
+// Returns ids of overflow pages referenced by given nodes, chains are ordered by nodes and pages by chains.
+func (p *PersistentStorage[K, V]) pageLayout(overflow overflowValues[K, V], nodes []uint) ([]uint, error) {
+	var (
+		layout []uint
+		seen   = make(map[uint]struct{})
+	)
+	for _, node := range nodes {
+		chains, err := overflow.pages(p, node)
+		if err != nil {
+			return nil, err
+		}
+		for _, chain := range chains {
+			var duplicate error
+			err := p.walkChain(chain, func(id uint, _ []byte) {
+				if _, found := seen[id]; found && duplicate == nil {
+					duplicate = fmt.Errorf("page %d is referenced more than once", id)
+				}
+				seen[id] = struct{}{}
+				layout = append(layout, id)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if duplicate != nil {
+				return nil, duplicate
+			}
+		}
+	}
+	return layout, nil
+}
+
+// moveSlot
+// Copies whole slot including padding, which is used by overflow pages, to another one.
+func (p *PersistentStorage[K, V]) moveSlot(from, to uint) error {
+	var data = make([]byte, p.paddedNodeSize)
+	if err := p.readAt(data, p.idToOffset(from)); err != nil {
+		return err
+	}
+	return p.writeAt(data, p.idToOffset(to))
+}
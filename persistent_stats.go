@@ -0,0 +1,73 @@
+package eternal
+
+import "errors"
+
+// StorageStats
+// Space usage of data file returned by PersistentStorage.Stats.
+type StorageStats struct {
+	FileSize int64
+	// NodeSize is size of serialized node, PaddedNodeSize is size of its slot aligned to block size
+	NodeSize, PaddedNodeSize int64
+	// PaddingWaste is number of bytes of all slots not used by nodes because of alignment
+	PaddingWaste int64
+	// Slots is number of all slots in file, used slots hold nodes or overflow pages, free slots are in chain
+	// of free ids
+	Slots, UsedSlots, FreeSlots uint
+	// Fragmentation is ratio of free slots to all slots, Defragment removes all free slots
+	Fragmentation float64
+	Depth         uint
+	// Nodes is number of nodes of the tree
+	Nodes uint
+	// FillFactor is average ratio of values in node to its capacity b-1
+	FillFactor float64
+	Keys       uint
+}
+
+// Stats
+// Returns space usage of data file. Whole tree and chain of free ids are read, so it takes as long as Check.
+// Storage must not be modified meanwhile.
+func (p *PersistentStorage[K, V]) Stats() (StorageStats, error) {
+	size, err := p.size()
+	if err != nil {
+		return StorageStats{}, err
+	}
+	free, err := p.freeIds()
+	if err != nil {
+		return StorageStats{}, err
+	}
+	stats := StorageStats{
+		FileSize:       size,
+		NodeSize:       p.nodeSize,
+		PaddedNodeSize: p.paddedNodeSize,
+		Slots:          uint((size - p.baseNodeAddress) / p.paddedNodeSize),
+		FreeSlots:      uint(len(free)),
+		Depth:          p.depth,
+	}
+	stats.PaddingWaste = int64(stats.Slots) * (stats.PaddedNodeSize - stats.NodeSize)
+	stats.UsedSlots = stats.Slots - min(stats.FreeSlots, stats.Slots)
+	if stats.Slots > 0 {
+		stats.Fragmentation = float64(stats.FreeSlots) / float64(stats.Slots)
+	}
+
+	var (
+		fill    float64
+		pending = []uint{rootId}
+	)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		node, err := p.Get(id)
+		if err != nil {
+			return StorageStats{}, err
+		}
+		stats.Nodes++
+		if stats.Nodes > stats.Slots {
+			return StorageStats{}, errors.New("tree contains cycle, run Check for details")
+		}
+		stats.Keys += uint(len(node.values))
+		fill += float64(len(node.values)) / float64(p.b-1)
+		pending = append(pending, node.children...)
+	}
+	stats.FillFactor = fill / float64(stats.Nodes)
+	return stats, nil
+}
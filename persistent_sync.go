@@ -0,0 +1,153 @@
+package eternal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// SyncPolicy
+// Determines when PersistentStorage syncs data file to disk, see WithDurability.
+type SyncPolicy uint8
+
+const (
+	// SyncManually syncs data file only when Sync (or Tree.Flush) is called and when storage is closed.
+	SyncManually SyncPolicy = iota + 1
+	// SyncEveryOperation syncs data file at the end of every tree operation, so acknowledged operation survives
+	// power loss.
+	SyncEveryOperation
+	// SyncPeriodically syncs data file in the background once per interval, all operations done meanwhile are
+	// synced at once (group commit).
+	SyncPeriodically
+)
+
+var _ DurableStorage = &PersistentStorage[string, any]{}
+
+// WithDurability
+// Syncs data file by given policy, interval is used only by SyncPeriodically. Tree metadata (depth and free id) are
+// held in memory and written only when data file is synced, after nodes they refer to are synced, so metadata never
+// reaches disk before the nodes. Storage must be closed, otherwise metadata changed since the last sync are lost
+// and the file no longer matches them, such file must be rebuilt by Recover.
+// Storage with write-ahead log syncs data file with every operation regardless of policy.
+// Without this option, metadata are written immediately and data file is synced only by Sync.
+func WithDurability(policy SyncPolicy, interval time.Duration) StorageOption {
+	return func(options *storageOptions) {
+		options.syncPolicy = policy
+		options.syncInterval = interval
+	}
+}
+
+// durability
+// State of syncing of data file. Metadata are published by tree operations and written by Sync, which may run
+// in the background, so they are guarded by lock.
+type durability struct {
+	policy   SyncPolicy
+	interval time.Duration
+	syncing  sync.Mutex // only one sync runs at once
+	lock     sync.Mutex // guards fields below
+	metadata []byte     // serialized depth and free id, which were not written yet
+	err      error      // error of background sync, returned by the next Sync
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// deferMetadata
+// Reports if metadata should be held until data file is synced.
+func (p *PersistentStorage[K, V]) deferMetadata() bool {
+	return p.durability != nil && p.log == nil
+}
+
+// writeMetadata
+// Writes depth and free id or publishes them for the next sync.
+func (p *PersistentStorage[K, V]) writeMetadata() error {
+	metadata := append(p.ids.Serialize(p.depth), p.ids.Serialize(p.freeId)...)
+	if !p.deferMetadata() {
+		return p.writeAt(metadata, p.depthAddress)
+	}
+	p.durability.lock.Lock()
+	defer p.durability.lock.Unlock()
+	p.durability.metadata = metadata
+	return nil
+}
+
+// Sync
+// Syncs data file to disk. Nodes are synced first and only then tree metadata referring to them are written
+// and synced. It can be called concurrently with tree operations. Error of failed background sync is returned
+// by the next Sync.
+func (p *PersistentStorage[K, V]) Sync() error {
+	if p.durability == nil {
+		return p.file.Sync()
+	}
+	p.durability.syncing.Lock()
+	defer p.durability.syncing.Unlock()
+	p.durability.lock.Lock()
+	metadata, previousErr := p.durability.metadata, p.durability.err
+	p.durability.metadata, p.durability.err = nil, nil
+	p.durability.lock.Unlock()
+
+	if err := p.syncMetadata(metadata); err != nil {
+		p.durability.lock.Lock()
+		// metadata are written by the next sync, unless newer ones were published meanwhile
+		if p.durability.metadata == nil {
+			p.durability.metadata = metadata
+		}
+		p.durability.lock.Unlock()
+		return errors.Join(previousErr, err)
+	}
+	return previousErr
+}
+
+// syncMetadata
+// Syncs nodes and then writes and syncs given metadata.
+func (p *PersistentStorage[K, V]) syncMetadata(metadata []byte) error {
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	if metadata == nil {
+		return nil
+	}
+	if _, err := p.file.WriteAt(metadata, p.depthAddress); err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+// startSync
+// Starts background sync of storage with SyncPeriodically policy.
+func (p *PersistentStorage[K, V]) startSync() {
+	if p.durability == nil || p.durability.policy != SyncPeriodically || p.log != nil {
+		return
+	}
+	p.durability.stop, p.durability.stopped = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(p.durability.stopped)
+		ticker := time.NewTicker(p.durability.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.durability.stop:
+				return
+			case <-ticker.C:
+				if err := p.Sync(); err != nil {
+					p.durability.lock.Lock()
+					p.durability.err = err
+					p.durability.lock.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// stopSync
+// Stops background sync and syncs remaining changes.
+func (p *PersistentStorage[K, V]) stopSync() error {
+	if p.durability == nil {
+		return nil
+	}
+	if p.durability.stop != nil {
+		close(p.durability.stop)
+		<-p.durability.stopped
+		p.durability.stop = nil
+	}
+	return p.Sync()
+}
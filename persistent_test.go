@@ -1,10 +1,18 @@
 package eternal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"math/bits"
+	"math/rand"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/zelezo001/eternal/encoding"
 )
 
@@ -12,10 +20,7 @@ func TestPersistentStorage(t *testing.T) {
 	t.Parallel()
 	const a, b = 2, 3
 	const blockSize = 16
-	temp, err := os.CreateTemp(t.TempDir(), "file")
-	if err != nil {
-		t.Fatalf("could not create file: %s", err)
-	}
+	temp := createTempFile(t, "file")
 	keySerializer, err := encoding.CreateForString[string](5)
 	if err != nil {
 		t.Fatal(err)
@@ -128,8 +133,1579 @@ func TestPersistentStorage(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not obtain info about file: %s", err)
 	}
-	const expectedFileSizeAfterTrimming = 320 + 98 + bits.UintSize/8*2 // 4 nodes with padding + header + two metadata uints
+	// 4 nodes with padding + header + two 64 bits metadata ids + schema section
+	const expectedFileSizeAfterTrimming = 448 + 98 + 8*2 + 4 + int64(len("tuple(string(5),uint(64))"))
 	if stat.Size() != expectedFileSizeAfterTrimming {
 		t.Fatalf("expected file to have size %d, file has size %d", expectedFileSizeAfterTrimming, stat.Size())
 	}
 }
+
+func TestPersistentStorage_DefragmentStep(t *testing.T) {
+	t.Parallel()
+	const a, b, count = 2, 3, 300
+	type Scenario struct {
+		name    string
+		options func() []StorageOption
+	}
+	for _, scenario := range []Scenario{
+		{name: "plain", options: func() []StorageOption { return nil }},
+		{name: "write-ahead log", options: func() []StorageOption {
+			return []StorageOption{WithWriteAheadLog(&MemoryFile{})}
+		}},
+		{name: "durability", options: func() []StorageOption {
+			return []StorageOption{WithDurability(SyncManually, 0)}
+		}},
+	} {
+		t.Run(scenario.name, func(t *testing.T) {
+			t.Parallel()
+			storage, file := createPersistentStorage(t, a, b, scenario.options()...)
+			tree, err := NewTree[int64, int64](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := make(map[int64]int64)
+			for i := int64(0); i < count; i++ {
+				assert.NoError(t, tree.Insert(i, -i))
+				expected[i] = -i
+			}
+			for i := int64(0); i < count; i++ {
+				if i%5 != 0 {
+					assert.NoError(t, tree.Delete(i))
+					delete(expected, i)
+				}
+			}
+			fragmentedSize, err := file.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			check := func() {
+				t.Helper()
+				report, err := storage.Check()
+				if assert.NoError(t, err) {
+					assert.Empty(t, report.Violations)
+					assert.Equal(t, len(expected), report.Values)
+				}
+				for key, value := range expected {
+					stored, err := tree.Get(key)
+					assert.NoError(t, err)
+					assert.Equal(t, value, stored)
+				}
+			}
+
+			var done bool
+			for step := int64(0); !done; step++ {
+				if step > count {
+					t.Fatal("defragmentation did not finish")
+				}
+				done, err = storage.DefragmentStep(3)
+				if !assert.NoError(t, err) {
+					return
+				}
+				check()
+				if step < 20 {
+					// tree operations between steps
+					assert.NoError(t, tree.Insert(count+step, step))
+					expected[count+step] = step
+					assert.NoError(t, tree.Delete(step*5))
+					delete(expected, step*5)
+					done = false
+				}
+			}
+			check()
+			assert.Equal(t, uint(noFreeId), storage.freeId)
+			size, err := file.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Less(t, size, fragmentedSize)
+			done, err = storage.DefragmentStep(3)
+			assert.NoError(t, err)
+			assert.True(t, done)
+		})
+	}
+}
+
+func TestPersistentStorage_Reorganize(t *testing.T) {
+	t.Parallel()
+	const a, b, count = 2, 3, 400
+	type Scenario struct {
+		order NodeOrder
+		name  string
+	}
+	for _, scenario := range []Scenario{
+		{order: BreadthFirst, name: "breadth first"},
+		{order: KeyOrder, name: "key order"},
+	} {
+		t.Run(scenario.name, func(t *testing.T) {
+			t.Parallel()
+			storage, file := createPersistentStorage(t, a, b)
+			tree, err := NewTree[int64, int64](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// scattered inserts and deletes place nodes randomly
+			for i := int64(0); i < count; i++ {
+				key := i * 7919 % count
+				assert.NoError(t, tree.Insert(key, -key))
+			}
+			for i := int64(0); i < count; i += 3 {
+				assert.NoError(t, tree.Delete(i))
+			}
+
+			assert.NoError(t, storage.Reorganize(scenario.order))
+			report, err := storage.Check()
+			if assert.NoError(t, err) {
+				assert.Empty(t, report.Violations)
+				assert.Equal(t, count-count/3-1, report.Values)
+			}
+			layout, err := storage.nodeLayout(scenario.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for position, id := range layout {
+				assert.Equal(t, uint(position), id)
+			}
+			assert.Equal(t, uint(noFreeId), storage.freeId)
+			size, err := file.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, storage.idToOffset(uint(len(layout))), size)
+
+			var previous int64 = -1
+			all, finish := tree.All()
+			for key, value := range all {
+				assert.Less(t, previous, key)
+				assert.Equal(t, -key, value)
+				previous = key
+			}
+			assert.NoError(t, finish())
+			// tree remains usable
+			assert.NoError(t, tree.Insert(count, count))
+			value, err := tree.Get(count)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(count), value)
+		})
+	}
+	t.Run("unknown order", func(t *testing.T) {
+		t.Parallel()
+		storage, _ := createPersistentStorage(t, a, b)
+		assert.Error(t, storage.Reorganize(0))
+	})
+}
+
+func TestPersistentStorage_Stats(t *testing.T) {
+	t.Parallel()
+	const a, b, count = 2, 3, 100
+	storage, file := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := storage.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(1), stats.Slots)
+	assert.Equal(t, uint(1), stats.Nodes)
+	assert.Zero(t, stats.Keys)
+	assert.Zero(t, stats.FillFactor)
+
+	for i := int64(0); i < count; i++ {
+		assert.NoError(t, tree.Insert(i, i))
+	}
+	for i := int64(0); i < count; i += 2 {
+		assert.NoError(t, tree.Delete(i))
+	}
+	stats, err = storage.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := file.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, size, stats.FileSize)
+	// padded to multiple of block size 64
+	assert.Equal(t, int64(128), stats.PaddedNodeSize)
+	assert.Equal(t, storage.nodeSize, stats.NodeSize)
+	assert.Equal(t, int64(stats.Slots)*(128-storage.nodeSize), stats.PaddingWaste)
+	assert.Equal(t, uint(count/2), stats.Keys)
+	assert.Equal(t, storage.GetDepth(), stats.Depth)
+	assert.NotZero(t, stats.FreeSlots)
+	assert.Equal(t, stats.Slots, stats.UsedSlots+stats.FreeSlots)
+	assert.Equal(t, stats.Nodes, stats.UsedSlots)
+	assert.InDelta(t, float64(stats.FreeSlots)/float64(stats.Slots), stats.Fragmentation, 1e-9)
+	assert.InDelta(t, float64(stats.Keys)/float64(stats.Nodes*(b-1)), stats.FillFactor, 1e-9)
+
+	assert.NoError(t, storage.Defragment())
+	defragmented, err := storage.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, defragmented.FreeSlots)
+	assert.Zero(t, defragmented.Fragmentation)
+	assert.Equal(t, stats.Nodes, defragmented.Slots)
+	assert.Less(t, defragmented.FileSize, stats.FileSize)
+}
+
+func createTempFile(t *testing.T, name string) OSFile {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), name)
+	if err != nil {
+		t.Fatalf("could not create file: %s", err)
+	}
+	return OSFile{file}
+}
+
+func createPersistentStorage(t *testing.T, a, b uint, options ...StorageOption) (*PersistentStorage[int64, int64], *MemoryFile) {
+	t.Helper()
+	file := &MemoryFile{}
+	serializer := encoding.CreateForPrimitive[int64]()
+	storage, err := NewPersistentStorage[int64, int64](a, b, 64, file, serializer, serializer, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = storage.Close()
+	})
+	return storage, file
+}
+
+func TestPersistentStorage_WriteAheadLog(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	log := &MemoryFile{}
+	storage, file := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logSize := func() int64 {
+		size, err := log.Size()
+		if err != nil {
+			t.Fatalf("could not obtain size of file: %s", err)
+		}
+		return size
+	}
+	for i := int64(0); i < 20; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+		if logSize() != 0 {
+			t.Fatalf("log should be empty after successful commit")
+		}
+	}
+	for i := int64(0); i < 20; i += 3 {
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("failed deleting value: %s", err)
+		}
+	}
+	(&treeChecker[int64, int64]{
+		testing:            t,
+		storage:            storage,
+		a:                  a,
+		b:                  b,
+		checkedNodes:       make(map[uint]struct{}),
+		expectedValueCount: 13,
+	}).checkTree()
+
+	t.Run("rollback", func(t *testing.T) {
+		size, err := file.Size()
+		if err != nil {
+			t.Fatalf("could not obtain size of file: %s", err)
+		}
+		depth := storage.GetDepth()
+		assert.NoError(t, storage.Begin())
+		for i := int64(100); i < 120; i++ {
+			assert.NoError(t, tree.insert(i, i))
+		}
+		assert.NoError(t, storage.Rollback())
+		tree.depth = storage.GetDepth()
+		assert.Equal(t, depth, storage.GetDepth())
+		_, err = tree.Get(100)
+		assert.ErrorIs(t, err, ErrNotFound)
+		afterRollback, err := file.Size()
+		if err != nil {
+			t.Fatalf("could not obtain size of file: %s", err)
+		}
+		assert.Equal(t, size, afterRollback)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		assert.NoError(t, storage.Begin())
+		for i := int64(200); i < 210; i++ {
+			assert.NoError(t, tree.insert(i, i))
+		}
+		// simulate crash after log was synced
+		batch := storage.batch
+		storage.batch = nil
+		assert.NoError(t, storage.writeLog(batch.writes))
+		assert.NoError(t, storage.loadMetadata())
+		tree.depth = storage.GetDepth()
+		_, err := tree.Get(200)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.NoError(t, storage.replayLog())
+		assert.NoError(t, storage.loadMetadata())
+		tree.depth = storage.GetDepth()
+		assert.Zero(t, logSize())
+		for i := int64(200); i < 210; i++ {
+			value, err := tree.Get(i)
+			assert.NoError(t, err)
+			assert.Equal(t, i, value)
+		}
+	})
+
+	t.Run("discard incomplete record", func(t *testing.T) {
+		assert.NoError(t, storage.Begin())
+		assert.NoError(t, tree.insert(300, 300))
+		batch := storage.batch
+		storage.batch = nil
+		assert.NoError(t, storage.writeLog(batch.writes))
+		// simulate torn write of the log
+		assert.NoError(t, log.Truncate(logSize()-1))
+		assert.NoError(t, storage.loadMetadata())
+		tree.depth = storage.GetDepth()
+
+		assert.NoError(t, storage.replayLog())
+		assert.Zero(t, logSize())
+		_, err := tree.Get(300)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// failingSyncFile
+// Fails every sync while failing is set.
+type failingSyncFile struct {
+	MemoryFile
+	failing bool
+}
+
+func (f *failingSyncFile) Sync() error {
+	if f.failing {
+		return errors.New("sync failed")
+	}
+	return f.MemoryFile.Sync()
+}
+
+func TestPersistentStorage_WriteAheadLogFailure(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	log := &failingSyncFile{}
+	storage, _ := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); ; i++ {
+		depth := storage.GetDepth()
+		log.failing = true
+		assert.Error(t, tree.Insert(i, i))
+		log.failing = false
+		// tree must not keep depth of the uncommitted batch
+		assert.Equal(t, depth, storage.GetDepth())
+		assert.Equal(t, depth, tree.depth)
+		_, err := tree.Get(i)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.NoError(t, tree.Insert(i, i))
+		if storage.GetDepth() > depth {
+			// failed insert would have changed depth as well
+			break
+		}
+	}
+	for i := int64(0); i < 5; i++ {
+		assert.NoError(t, tree.Insert(100+i, i))
+	}
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+}
+
+func TestPersistentStorage_Txn(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	log := createTempFile(t, "log")
+	storage, file := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 10; i++ {
+		assert.NoError(t, tree.Insert(i, i))
+	}
+	content := file.Bytes()
+	// new nodes get provisional ids, nothing is written to storage before commit
+	txn := tree.Begin()
+	for i := int64(10); i < 40; i++ {
+		assert.NoError(t, txn.Insert(i, i))
+	}
+	assert.Equal(t, content, file.Bytes())
+	assert.NoError(t, txn.Rollback())
+	assert.Equal(t, content, file.Bytes())
+
+	txn = tree.Begin()
+	for i := int64(10); i < 40; i++ {
+		assert.NoError(t, txn.Insert(i, i))
+	}
+	for i := int64(0); i < 10; i++ {
+		assert.NoError(t, txn.Delete(i))
+	}
+	assert.Equal(t, content, file.Bytes())
+	assert.NoError(t, txn.Commit())
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	(&treeChecker[int64, int64]{
+		testing:            t,
+		storage:            storage,
+		a:                  a,
+		b:                  b,
+		checkedNodes:       make(map[uint]struct{}),
+		expectedValueCount: 30,
+	}).checkTree()
+	for i := int64(10); i < 40; i++ {
+		value, err := tree.Get(i)
+		assert.NoError(t, err)
+		assert.Equal(t, i, value)
+	}
+}
+
+func TestPersistentStorage_Checksum(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	storage, file := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 10; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	root, err := storage.GetRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptedId := root.children[0]
+	// flip byte of the first stored value, as torn write would do
+	offset := storage.idToOffset(corruptedId) + int64(boolSerializer.Size()+checksumSerializer.Size()) + 4
+	data := make([]byte, 1)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if _, err := file.WriteAt(data, offset); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.Get(corruptedId)
+	assert.ErrorIs(t, err, ErrCorruptedNode)
+	var corruptedErr *CorruptedNodeError
+	if assert.ErrorAs(t, err, &corruptedErr) {
+		assert.Equal(t, corruptedId, corruptedErr.Id)
+	}
+	_, err = tree.Get(0)
+	assert.ErrorIs(t, err, ErrCorruptedNode)
+	// other nodes are still readable
+	_, err = storage.Get(root.children[1])
+	assert.NoError(t, err)
+}
+
+func TestPersistentStorage_BaselineFile(t *testing.T) {
+	t.Parallel()
+	// file of version 1 without checksums and schema, created as (2,3)-tree with block size 64 by inserting keys
+	// 1 to 40 with negated values and deleting keys 31 to 40
+	content, err := os.ReadFile("testdata/baseline_v1.eternal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := NewMemoryFile(content)
+	serializer := encoding.CreateForPrimitive[int64]()
+	storage, err := OpenPersistentStorage[int64, int64](file, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, storage.checksums)
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	assert.Equal(t, 30, report.Values)
+	tree, err := NewTreeFromStorage[int64, int64](storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 40; i++ {
+		value, err := tree.Get(i)
+		if i > 30 {
+			assert.ErrorIs(t, err, ErrNotFound)
+		} else if assert.NoError(t, err) {
+			assert.Equal(t, -i, value)
+		}
+	}
+
+	// file is modified in its own layout
+	for i := int64(41); i <= 60; i++ {
+		assert.NoError(t, tree.Insert(i, -i))
+	}
+	assert.NoError(t, storage.Close())
+	info, err := Probe(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint16(1), info.Version)
+	reopened, err := OpenPersistentStorage[int64, int64](file, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	report, err = reopened.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	assert.Equal(t, 50, report.Values)
+}
+
+func TestPersistentStorage_Check(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	storage, _ := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 30; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	for i := int64(0); i < 30; i += 2 {
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("failed deleting value: %s", err)
+		}
+	}
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	assert.Equal(t, 15, report.Values)
+	if storage.freeId == noFreeId {
+		t.Fatal("deletion should free some nodes")
+	}
+
+	root, err := storage.GetRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// free chain pointing to node in use
+	freeId := storage.freeId
+	assert.NoError(t, storage.updateFreeId(root.children[0]))
+	report, err = storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, report.Violations, 2) {
+		assert.Equal(t, ViolationReachableFree, report.Violations[0].Kind)
+		assert.Equal(t, ViolationFreeChain, report.Violations[1].Kind)
+		assert.Equal(t, root.children[0], report.Violations[1].NodeId)
+	}
+
+	// free node referenced from tree
+	assert.NoError(t, storage.updateFreeId(freeId))
+	root.children[0] = freeId
+	assert.NoError(t, storage.Persist(root))
+	report, err = storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, report.Valid())
+	assert.Equal(t, ViolationReachableFree, report.Violations[0].Kind)
+	assert.Equal(t, freeId, report.Violations[0].NodeId)
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	storage, file := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 50; i++ {
+		if err := tree.Insert(i, i*10); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	root, err := storage.GetRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := storage.Get(root.children[0])
+	for err == nil && !leaf.leaf {
+		leaf, err = storage.Get(leaf.children[0])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := make(map[int64]struct{})
+	for _, node := range []Node[int64, int64]{root, leaf} {
+		for _, value := range node.values {
+			lost[value.First] = struct{}{}
+		}
+	}
+	// damage header, root and one leaf, values stored in corrupted nodes are lost
+	garbage := []byte("garbage")
+	for _, offset := range []int64{
+		0,
+		storage.idToOffset(root.id) + int64(boolSerializer.Size()),
+		storage.idToOffset(leaf.id) + int64(boolSerializer.Size()),
+	} {
+		if _, err := file.WriteAt(garbage, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := createTempFile(t, "recovered")
+	serializer := encoding.CreateForPrimitive[int64]()
+	recovered, report, err := Recover[int64, int64](a, b, 64, file, dst, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	assert.Equal(t, 2, report.CorruptedNodes)
+	assert.Zero(t, report.ReachableNodes)
+	assert.Equal(t, 50-len(lost), report.Values)
+	recoveredTree, err := NewTree[int64, int64](a, b, recovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 50; i++ {
+		value, err := recoveredTree.Get(i)
+		if _, isLost := lost[i]; isLost {
+			assert.ErrorIs(t, err, ErrNotFound)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, i*10, value)
+	}
+	check, err := recovered.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, check.Valid(), check.Violations)
+}
+
+func TestPersistentStorage_BulkLoad(t *testing.T) {
+	t.Parallel()
+	const a, b = 3, 5
+	storage, _ := createPersistentStorage(t, a, b)
+	tree, err := BulkLoad[int64, int64](a, b, 0.8, storage, func(yield func(int64, int64) bool) {
+		for i := int64(0); i < 1000; i++ {
+			if !yield(i, -i) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.Valid(), report.Violations)
+	assert.Equal(t, 1000, report.Values)
+	value, err := tree.Get(500)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-500), value)
+}
+
+func TestPersistentStorage_Overflow(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	type document struct {
+		Name    string
+		Payload []byte
+	}
+	file := createTempFile(t, "file")
+	valueSerializer, err := encoding.CreateVariable[document]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewPersistentStorageWithOverflow[int64, document](a, b, 64, file,
+		encoding.CreateForPrimitive[int64](), valueSerializer, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	tree, err := NewTree[int64, document](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(7))
+	createDocument := func(key int64) document {
+		payload := make([]byte, random.Intn(2000))
+		random.Read(payload)
+		return document{Name: fmt.Sprintf("document %d", key), Payload: payload}
+	}
+	expected := make(map[int64]document)
+	fill := func() {
+		for i := 0; i < 300; i++ {
+			key := random.Int63n(100)
+			value := createDocument(key)
+			if err := tree.Insert(key, value); err != nil {
+				t.Fatalf("failed inserting value: %s", err)
+			}
+			expected[key] = value
+		}
+	}
+	checkValues := func() {
+		for key, expectedValue := range expected {
+			value, err := tree.Get(key)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expectedValue, value)
+			}
+		}
+		report, err := storage.Check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, report.Valid(), report.Violations)
+		assert.Equal(t, len(expected), report.Values)
+	}
+	fileSize := func() int64 {
+		stat, err := file.Stat()
+		if err != nil {
+			t.Fatalf("could not obtain info about file: %s", err)
+		}
+		return stat.Size()
+	}
+
+	fill()
+	checkValues()
+	sizeAfterFill := fileSize()
+	for key := range expected {
+		assert.NoError(t, tree.Delete(key))
+		delete(expected, key)
+	}
+	checkValues()
+	// pages of deleted values are reused
+	fill()
+	checkValues()
+	assert.Less(t, fileSize(), sizeAfterFill*3/2)
+	assert.ErrorIs(t, storage.Defragment(), ErrOverflowUnsupported)
+	_, err = storage.DefragmentStep(10)
+	assert.ErrorIs(t, err, ErrOverflowUnsupported)
+	serializer := encoding.CreateForPrimitive[int64]()
+	_, _, err = Recover[int64, int64](a, b, 64, file, &MemoryFile{}, serializer, serializer)
+	assert.ErrorIs(t, err, ErrOverflowUnsupported)
+
+	// reorganization moves pages as well and leaves no free slots
+	for key := range expected {
+		if key%2 == 0 {
+			assert.NoError(t, tree.Delete(key))
+			delete(expected, key)
+		}
+	}
+	sizeBeforeReorganization := fileSize()
+	assert.NoError(t, storage.Reorganize(KeyOrder))
+	assert.Less(t, fileSize(), sizeBeforeReorganization)
+	assert.Equal(t, uint(noFreeId), storage.freeId)
+	checkValues()
+	fill()
+	checkValues()
+
+	// unchanged values keep their pages
+	root, err := storage.GetRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := storage.values.pages(storage, root.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("root should contain value stored in overflow pages")
+	}
+	freeId := storage.freeId
+	assert.NoError(t, storage.Persist(root))
+	persistedPages, err := storage.values.pages(storage, root.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pages, persistedPages)
+	assert.Equal(t, freeId, storage.freeId)
+
+	// damaged page is detected, when its chain is not cached
+	if _, err := file.WriteAt([]byte("garbage"), storage.idToOffset(pages[0])+20); err != nil {
+		t.Fatal(err)
+	}
+	storage.chains.clear()
+	_, err = storage.GetRoot()
+	assert.ErrorIs(t, err, ErrCorruptedNode)
+
+	// pages of damaged node cannot be found, so it cannot be removed
+	leaf := root
+	for !leaf.leaf {
+		if leaf, err = storage.loadWithoutValues(leaf.children[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := file.WriteAt([]byte("garbage"), storage.idToOffset(leaf.id)+10); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, storage.Remove(leaf.id), ErrCorruptedNode)
+}
+
+func TestPersistentStorage_ValueTooLarge(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	type Scenario struct {
+		Name     string
+		Options  []StorageOption
+		Truncate bool
+	}
+	scenarios := []Scenario{
+		{Name: "rejected"},
+		{Name: "truncated", Options: []StorageOption{WithTruncation()}, Truncate: true},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			file := createTempFile(t, "file")
+			valueSerializer, err := encoding.CreateForString[string](4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			storage, err := NewPersistentStorage[int64, string](a, b, 64, file,
+				encoding.CreateForPrimitive[int64](), valueSerializer, scenario.Options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+			tree, err := NewTree[int64, string](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := int64(0); i < 10; i++ {
+				assert.NoError(t, tree.Insert(i, "abcd"))
+			}
+
+			err = tree.Insert(5, "abcdef")
+			txn := tree.Begin()
+			txnErr := txn.Insert(20, "abcdef")
+			assert.NoError(t, txn.Rollback())
+			value, getErr := tree.Get(5)
+			assert.NoError(t, getErr)
+			if scenario.Truncate {
+				assert.NoError(t, err)
+				assert.NoError(t, txnErr)
+				assert.Equal(t, "abcd", value)
+				return
+			}
+			var tooLarge *encoding.ValueTooLargeError
+			if assert.ErrorAs(t, err, &tooLarge) {
+				assert.Equal(t, encoding.ValueTooLargeError{Path: "Second", Length: 6, Limit: 4}, *tooLarge)
+			}
+			assert.ErrorIs(t, txnErr, encoding.ErrValueTooLarge)
+			// rejected value does not change the tree
+			assert.Equal(t, "abcd", value)
+			report, err := tree.Verify()
+			if assert.NoError(t, err) {
+				assert.True(t, report.Valid(), report.Violations)
+				assert.Equal(t, 10, report.Values)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 5
+	type recordV1 struct {
+		Name    string `eternal:"size=4"`
+		Count   int16
+		Removed bool
+	}
+	type recordV2 struct {
+		Count int64
+		Name  string `eternal:"size=8"`
+		Added uint8
+	}
+	v1Serializer, err := encoding.Create[recordV1]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Serializer, err := encoding.Create[recordV2]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyV1 := encoding.CreateForPrimitive[int32]()
+	keyV2 := encoding.CreateForPrimitive[int64]()
+	const count = 100
+	createOldFile := func(t *testing.T) File {
+		file := createTempFile(t, "file")
+		storage, err := NewPersistentStorage[int32, recordV1](a, b, 64, file, keyV1, v1Serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := NewTree[int32, recordV1](a, b, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int32(-count / 2); i < count/2; i++ {
+			if err := tree.Insert(i, recordV1{Name: fmt.Sprint(i), Count: int16(i * 3), Removed: true}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return file
+	}
+	checkMigrated := func(t *testing.T, storage *PersistentStorage[int64, recordV2]) {
+		tree, err := NewTree[int64, recordV2](a, b, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := tree.Verify()
+		if assert.NoError(t, err) {
+			assert.True(t, report.Valid(), report.Violations)
+			assert.Equal(t, count, report.Values)
+		}
+		for i := int64(-count / 2); i < count/2; i++ {
+			value, err := tree.Get(i)
+			if assert.NoError(t, err) {
+				assert.Equal(t, recordV2{Count: i * 3, Name: fmt.Sprint(i)}, value)
+			}
+		}
+		// migrated storage is writable with the new type
+		assert.NoError(t, tree.Insert(1000, recordV2{Name: "12345678"}))
+	}
+
+	t.Run("new file", func(t *testing.T) {
+		t.Parallel()
+		src := createOldFile(t)
+		dst := createTempFile(t, "migrated")
+		storage, err := Migrate[int64, recordV2](src, dst, keyV2, v2Serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer storage.Close()
+		checkMigrated(t, storage)
+	})
+	t.Run("in place", func(t *testing.T) {
+		t.Parallel()
+		storage, err := MigrateInPlace[int64, recordV2](createOldFile(t), keyV2, v2Serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer storage.Close()
+		checkMigrated(t, storage)
+	})
+	t.Run("incompatible", func(t *testing.T) {
+		t.Parallel()
+		file := createOldFile(t)
+		_, err := MigrateInPlace[int16, recordV2](file, encoding.CreateForPrimitive[int16](), v2Serializer)
+		assert.ErrorIs(t, err, encoding.ErrIncompatibleSchema)
+		// file is not changed
+		storage, err := MigrateInPlace[int32, recordV1](file, keyV1, v1Serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer storage.Close()
+		tree, err := NewTree[int32, recordV1](a, b, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := tree.Get(7)
+		assert.NoError(t, err)
+		assert.Equal(t, recordV1{Name: "7", Count: 21, Removed: true}, value)
+	})
+	t.Run("file without schema", func(t *testing.T) {
+		t.Parallel()
+		content, err := os.ReadFile("testdata/baseline_v1.eternal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// schema of file is derived from serializers matching its signature
+		_, err = Migrate[int64, recordV2](NewMemoryFile(content), NewMemoryFile(nil), keyV2, v2Serializer)
+		assert.ErrorIs(t, err, ErrSchemaMismatch)
+		serializer := encoding.CreateForPrimitive[int64]()
+		file := NewMemoryFile(content)
+		storage, err := MigrateInPlace[int64, int64](file, serializer, serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := NewTreeFromStorage[int64, int64](storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(1); i <= 30; i++ {
+			value, err := tree.Get(i)
+			if assert.NoError(t, err) {
+				assert.Equal(t, -i, value)
+			}
+		}
+		assert.NoError(t, storage.Close())
+		info, err := Probe(file)
+		if assert.NoError(t, err) {
+			assert.Equal(t, uint16(currentVersion), info.Version)
+		}
+		schema, err := ReadSchema(file)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "tuple(int(64),int(64))", schema.String())
+		}
+	})
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	type record struct {
+		Name  string `eternal:"size=8"`
+		Score float64
+	}
+	file := createTempFile(t, "file")
+	valueSerializer, err := encoding.Create[record]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewPersistentStorage[uint16, record](a, b, 32, file, encoding.CreateForPrimitive[uint16](),
+		valueSerializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTree[uint16, record](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint16(20); i > 0; i-- {
+		assert.NoError(t, tree.Insert(i, record{Name: fmt.Sprint("rec ", i), Score: float64(i) / 2}))
+	}
+
+	schema, err := ReadSchema(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `tuple(uint(16),struct("github.com/zelezo001/eternal.record",{Name:string(8),Score:float(64)}))`,
+			schema.String())
+	}
+	inspector, err := Inspect(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, schema, inspector.Schema())
+	all, finish := inspector.All()
+	expectedKey := uint16(1)
+	for key, value := range all {
+		assert.Equal(t, expectedKey, key)
+		assert.Equal(t, map[string]any{
+			"Name":  fmt.Sprint("rec ", expectedKey),
+			"Score": float64(expectedKey) / 2,
+		}, value)
+		expectedKey++
+	}
+	assert.NoError(t, finish())
+	assert.Equal(t, uint16(21), expectedKey)
+
+	empty := createTempFile(t, "empty")
+	_, err = Inspect(empty)
+	assert.Error(t, err)
+}
+
+func TestPersistentStorage_LegacyLayout(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	file := createTempFile(t, "file")
+	serializer := encoding.CreateForPrimitive[int64]()
+	codec, err := newInlineValues(b, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := newPersistentStorage[int64, int64](a, b, 1, file, codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentNodeSize := storage.nodeSize
+	// file of version 3 created on 32 bits system stores ids as uint32
+	legacy := header{
+		Identifier: eternalIdentifier,
+		Version:    schemaVersion,
+		BlockSize:  1,
+		Signature:  codec.signature(),
+		A:          a,
+		B:          b,
+		System:     32,
+	}
+	if err := storage.setLayout(legacy); err != nil {
+		t.Fatal(err)
+	}
+	// 32 bits ids and no counts of values in subtrees
+	assert.Equal(t, currentNodeSize-b*4-(4+b*8), storage.nodeSize)
+	assert.NoError(t, storage.writeAt(headerSerializer.Serialize(legacy), 0))
+	assert.NoError(t, storage.SetDepth(1))
+	assert.NoError(t, storage.updateFreeId(noFreeId))
+	assert.NoError(t, storage.writeSchema(codec.schema().String()))
+	id, err := storage.NewId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, storage.Persist(Node[int64, int64]{id: id, values: make(values[int64, int64], 0), leaf: true}))
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 30; i++ {
+		assert.NoError(t, tree.Insert(i, -i))
+	}
+	for i := int64(1); i <= 30; i += 3 {
+		assert.NoError(t, tree.Delete(i))
+	}
+
+	inspector, err := Inspect(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, finish := inspector.All()
+	var keys []any
+	for key, value := range all {
+		assert.Equal(t, -key.(int64), value)
+		keys = append(keys, key)
+	}
+	assert.NoError(t, finish())
+	assert.Len(t, keys, 20)
+
+	// counts of values in subtrees are not stored, order statistics scan values
+	assert.False(t, storage.CountsSubtrees())
+	length, err := tree.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(20), length)
+	rank, err := tree.Rank(30)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(19), rank)
+	migrated, err := Migrate[int64, int64](file, &MemoryFile{}, serializer, serializer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, migrated.CountsSubtrees())
+	root, err := migrated.GetRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, known := root.size()
+	assert.True(t, known)
+	assert.Equal(t, uint(20), size)
+}
+
+func TestOpenPersistentStorage(t *testing.T) {
+	t.Parallel()
+	storage, _ := createPersistentStorage(t, 3, 5)
+	a, b := storage.Parameters()
+	assert.Equal(t, uint(3), a)
+	assert.Equal(t, uint(5), b)
+	assert.Equal(t, int64(64), storage.BlockSize())
+	tree, err := NewTreeFromStorage[int64, int64](storage)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(3), tree.a)
+		assert.Equal(t, uint(5), tree.b)
+	}
+
+	empty := createTempFile(t, "empty")
+	serializer := encoding.CreateForPrimitive[int64]()
+	_, err = OpenPersistentStorage[int64, int64](empty, serializer, serializer)
+	assert.Error(t, err)
+
+	t.Run("reopen populated file", func(t *testing.T) {
+		t.Parallel()
+		storage, file := createPersistentStorage(t, 2, 3)
+		tree, err := NewTreeFromStorage[int64, int64](storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 50; i++ {
+			assert.NoError(t, tree.Insert(i, -i))
+		}
+		assert.NoError(t, storage.Close())
+
+		reopened, err := OpenPersistentStorage[int64, int64](file, serializer, serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+		tree, err = NewTreeFromStorage[int64, int64](reopened)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 50; i++ {
+			value, err := tree.Get(i)
+			if assert.NoError(t, err) {
+				assert.Equal(t, -i, value)
+			}
+		}
+	})
+}
+
+func TestPersistentStorage_Reopen(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 5
+	storage, file := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 100; i++ {
+		assert.NoError(t, tree.Insert(i, i*i))
+	}
+	for i := int64(2); i <= 100; i += 2 {
+		assert.NoError(t, tree.Delete(i))
+	}
+
+	serializer := encoding.CreateForPrimitive[int64]()
+	checkReopened := func(t *testing.T, reopened *PersistentStorage[int64, int64]) {
+		assert.Equal(t, storage.GetDepth(), reopened.GetDepth())
+		assert.Equal(t, storage.freeId, reopened.freeId)
+		tree, err := NewTreeFromStorage[int64, int64](reopened)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(1); i <= 100; i++ {
+			value, err := tree.Get(i)
+			if i%2 == 0 {
+				assert.ErrorIs(t, err, ErrNotFound)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, i*i, value)
+			}
+		}
+		assert.NoError(t, tree.Insert(200, 1))
+		assert.NoError(t, tree.Delete(200))
+	}
+	reopened, err := NewPersistentStorage[int64, int64](a, b, 64, file, serializer, serializer)
+	if assert.NoError(t, err) {
+		checkReopened(t, reopened)
+	}
+	reopened, err = OpenPersistentStorage[int64, int64](file, serializer, serializer)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(64), reopened.BlockSize())
+		checkReopened(t, reopened)
+	}
+	_, err = NewPersistentStorage[int64, int64](a, 3, 64, file, serializer, serializer)
+	assert.Error(t, err)
+	_, err = NewPersistentStorage[int64, int32](a, b, 64, file, serializer, encoding.CreateForPrimitive[int32]())
+	assert.ErrorIs(t, err, ErrSchemaMismatch)
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	storage, file := createPersistentStorage(t, a, b)
+	tree, err := NewTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 20; i++ {
+		assert.NoError(t, tree.Insert(i, i))
+	}
+	size, err := file.Size()
+	if err != nil {
+		t.Fatalf("could not obtain size of file: %s", err)
+	}
+	expected := FileInfo{
+		Valid:      true,
+		Version:    currentVersion,
+		BlockSize:  64,
+		A:          a,
+		B:          b,
+		SystemBits: bits.UintSize,
+		Depth:      storage.GetDepth(),
+		Slots:      uint((size - storage.baseNodeAddress) / storage.paddedNodeSize),
+		SlotsKnown: true,
+	}
+	info, err := Probe(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, info)
+		assert.Greater(t, info.Slots, uint(1))
+	}
+	// reader without size is measured by reading
+	info, err = Probe(struct{ io.ReaderAt }{bytes.NewReader(file.Bytes())})
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, info)
+	}
+
+	// size of node is not known for files without schema and with overflow pages
+	baseline, err := os.ReadFile("testdata/baseline_v1.eternal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = Probe(bytes.NewReader(baseline))
+	if assert.NoError(t, err) {
+		assert.True(t, info.Valid)
+		assert.Equal(t, uint16(1), info.Version)
+		assert.Equal(t, uint(4), info.Depth)
+		assert.False(t, info.SlotsKnown)
+	}
+	valueSerializer, err := encoding.CreateVariable[string]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overflowFile := &MemoryFile{}
+	overflow, err := NewPersistentStorageWithOverflow[int64, string](a, b, 64, overflowFile,
+		encoding.CreateForPrimitive[int64](), valueSerializer, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, overflow.Close())
+	info, err = Probe(overflowFile)
+	if assert.NoError(t, err) {
+		assert.True(t, info.Valid)
+		assert.Equal(t, uint(1), info.Depth)
+		assert.False(t, info.SlotsKnown)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":       nil,
+		"short":       []byte("eternal"),
+		"not eternal": bytes.Repeat([]byte{1}, 200),
+	} {
+		info, err := Probe(bytes.NewReader(data))
+		assert.NoError(t, err, name)
+		assert.False(t, info.Valid, name)
+	}
+}
+
+func TestPersistentStorage_MemoryMap(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 5
+	serializer := encoding.CreateForPrimitive[int64]()
+	_, err := NewPersistentStorage[int64, int64](a, b, 64, &MemoryFile{}, serializer, serializer, WithMemoryMap())
+	assert.ErrorIs(t, err, ErrMemoryMapUnsupported)
+	file := createTempFile(t, "file")
+	storage, err := NewPersistentStorage[int64, int64](a, b, 64, file, serializer, serializer, WithMemoryMap())
+	if !memoryMapSupported {
+		assert.ErrorIs(t, err, ErrMemoryMapUnsupported)
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = storage.Close()
+	})
+	tree, err := NewConcurrentTree[int64, int64](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const count = 500
+	for i := int64(0); i < count; i++ {
+		assert.NoError(t, tree.Insert(i, -i))
+	}
+	var wait sync.WaitGroup
+	for worker := range int64(4) {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := worker; i < count; i += 4 {
+				value, err := tree.Get(i)
+				assert.NoError(t, err)
+				assert.Equal(t, -i, value)
+			}
+		}()
+	}
+	wait.Wait()
+	for i := int64(0); i < count; i += 2 {
+		assert.NoError(t, tree.Delete(i))
+	}
+	assert.NoError(t, storage.Defragment())
+	// file grows again after it was truncated
+	for i := int64(count); i < 2*count; i++ {
+		assert.NoError(t, tree.Insert(i, -i))
+	}
+	report, err := storage.Check()
+	if assert.NoError(t, err) {
+		assert.Empty(t, report.Violations)
+	}
+
+	reopened, err := OpenPersistentStorage[int64, int64](file, serializer, serializer, WithMemoryMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopenedTree, err := NewTreeFromStorage[int64, int64](reopened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 2*count; i++ {
+		value, err := reopenedTree.Get(i)
+		if i < count && i%2 == 0 {
+			assert.ErrorIs(t, err, ErrNotFound)
+		} else if assert.NoError(t, err) {
+			assert.Equal(t, -i, value)
+		}
+	}
+	assert.NoError(t, reopened.mapping.Close())
+}
+
+// syncRecordingFile
+// Records writes of tree metadata and syncs.
+type syncRecordingFile struct {
+	MemoryFile
+	metadataAddress int64
+	lock            sync.Mutex
+	events          []string
+}
+
+func (s *syncRecordingFile) WriteAt(data []byte, offset int64) (int, error) {
+	if offset == s.metadataAddress {
+		s.record("metadata")
+	}
+	return s.MemoryFile.WriteAt(data, offset)
+}
+
+func (s *syncRecordingFile) Sync() error {
+	s.record("sync")
+	return s.MemoryFile.Sync()
+}
+
+func (s *syncRecordingFile) record(event string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *syncRecordingFile) takeEvents() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestPersistentStorage_Durability(t *testing.T) {
+	t.Parallel()
+	const a, b = 2, 3
+	serializer := encoding.CreateForPrimitive[int64]()
+	// every write of metadata must be preceded by sync of nodes and followed by its own sync
+	checkOrder := func(t *testing.T, events []string) {
+		for i, event := range events {
+			if event == "metadata" {
+				assert.True(t, i > 0 && events[i-1] == "sync", "metadata written before sync")
+				assert.True(t, i+1 < len(events) && events[i+1] == "sync", "metadata not synced")
+			}
+		}
+	}
+	create := func(t *testing.T, policy SyncPolicy, interval time.Duration) (
+		*PersistentStorage[int64, int64], *Tree[int64, int64], *syncRecordingFile,
+	) {
+		file := &syncRecordingFile{metadataAddress: 98}
+		storage, err := NewPersistentStorage[int64, int64](a, b, 64, file, serializer, serializer,
+			WithDurability(policy, interval))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := NewTreeFromStorage[int64, int64](storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// metadata of new file are synced immediately
+		events := file.takeEvents()
+		assert.Contains(t, events, "metadata")
+		checkOrder(t, events)
+		return storage, tree, file
+	}
+	storedMetadata := func(storage *PersistentStorage[int64, int64], file *syncRecordingFile) (uint, uint) {
+		data := file.Bytes()[storage.depthAddress:]
+		return storage.ids.Deserialize(data), storage.ids.Deserialize(data[storage.ids.Size():])
+	}
+
+	t.Run("manually", func(t *testing.T) {
+		t.Parallel()
+		storage, tree, file := create(t, SyncManually, 0)
+		for i := int64(0); i < 20; i++ {
+			assert.NoError(t, tree.Insert(i, i))
+		}
+		assert.NoError(t, tree.Delete(5))
+		assert.Empty(t, file.takeEvents())
+		depth, _ := storedMetadata(storage, file)
+		assert.Equal(t, uint(1), depth)
+
+		assert.NoError(t, tree.Flush())
+		// nodes are synced before metadata are written
+		assert.Equal(t, []string{"sync", "metadata", "sync"}, file.takeEvents())
+		depth, freeId := storedMetadata(storage, file)
+		assert.Equal(t, storage.GetDepth(), depth)
+		assert.Equal(t, storage.freeId, freeId)
+		assert.NoError(t, tree.Flush())
+		assert.Equal(t, []string{"sync"}, file.takeEvents())
+	})
+
+	t.Run("every operation", func(t *testing.T) {
+		t.Parallel()
+		storage, tree, file := create(t, SyncEveryOperation, 0)
+		for i := int64(0); i < 20; i++ {
+			assert.NoError(t, tree.Insert(i, i))
+			depth, freeId := storedMetadata(storage, file)
+			assert.Equal(t, storage.GetDepth(), depth)
+			assert.Equal(t, storage.freeId, freeId)
+		}
+		checkOrder(t, file.takeEvents())
+	})
+
+	t.Run("periodically", func(t *testing.T) {
+		t.Parallel()
+		storage, tree, file := create(t, SyncPeriodically, time.Millisecond)
+		for i := int64(0); i < 20; i++ {
+			assert.NoError(t, tree.Insert(i, i))
+		}
+		assert.Eventually(t, func() bool {
+			depth, _ := storedMetadata(storage, file)
+			return depth == storage.GetDepth()
+		}, time.Second, time.Millisecond)
+		assert.NoError(t, tree.Delete(3))
+		assert.NoError(t, storage.Close())
+		checkOrder(t, file.takeEvents())
+		depth, freeId := storedMetadata(storage, file)
+		assert.Equal(t, storage.GetDepth(), depth)
+		assert.Equal(t, storage.freeId, freeId)
+	})
+
+	t.Run("recover without sync", func(t *testing.T) {
+		t.Parallel()
+		// storage is abandoned without sync or close, as by killed process, so its metadata are stale
+		_, tree, file := create(t, SyncManually, 0)
+		for i := int64(0); i < 30; i++ {
+			assert.NoError(t, tree.Insert(i, -i))
+		}
+		for i := int64(0); i < 30; i += 2 {
+			assert.NoError(t, tree.Delete(i))
+		}
+
+		recovered, report, err := Recover[int64, int64](a, b, 64, &file.MemoryFile, &MemoryFile{}, serializer,
+			serializer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer recovered.Close()
+		assert.Equal(t, 15, report.Values)
+		recoveredTree, err := NewTreeFromStorage[int64, int64](recovered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 30; i++ {
+			value, err := recoveredTree.Get(i)
+			if i%2 == 0 {
+				assert.ErrorIs(t, err, ErrNotFound)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, -i, value)
+			}
+		}
+	})
+
+	_, err := NewPersistentStorage[int64, int64](a, b, 64, &MemoryFile{}, serializer, serializer,
+		WithDurability(SyncPeriodically, 0))
+	assert.Error(t, err)
+}
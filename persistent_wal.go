@@ -0,0 +1,304 @@
+package eternal
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+type (
+	walRecordHeader struct {
+		Identifier identifier
+		Writes     uint32
+	}
+	walWriteHeader struct {
+		Offset int64
+		Length uint32
+	}
+)
+
+var (
+	walIdentifier = identifier{'e', 't', 'e', 'r', 'w', 'a', 'l'}
+
+	walRecordHeaderSerializer encoding.Serializer[walRecordHeader]
+	walWriteHeaderSerializer  encoding.Serializer[walWriteHeader]
+
+	_ AtomicStorage = &PersistentStorage[string, any]{}
+)
+
+func init() {
+	var err error
+	walRecordHeaderSerializer, err = encoding.Create[walRecordHeader]()
+	if err != nil {
+		panic(fmt.Errorf("could not create serializer for log record header: %w", err))
+	}
+	walWriteHeaderSerializer, err = encoding.Create[walWriteHeader]()
+	if err != nil {
+		panic(fmt.Errorf("could not create serializer for log write header: %w", err))
+	}
+}
+
+// WithWriteAheadLog
+// Makes every tree operation atomic on disk. All writes done by one operation are firstly stored to log file and
+// applied to the data file only after the log is synced. Complete log left by crashed process is replayed when
+// storage is created, incomplete one is discarded. Log file must be used only with one data file.
+func WithWriteAheadLog(log File) StorageOption {
+	return func(options *storageOptions) {
+		options.log = log
+	}
+}
+
+type pendingWrite struct {
+	offset int64
+	data   []byte
+}
+
+// writeBatch
+// Holds writes of one atomic operation, so they can be logged and applied at once.
+type writeBatch struct {
+	writes []pendingWrite
+	size   int64 // size of the file after pending writes are applied
+	// metadata at the beginning of batch, they are restored on rollback
+	depth, freeId uint
+}
+
+func (b *writeBatch) add(data []byte, offset int64) {
+	end := offset + int64(len(data))
+	// drop writes which are completely overwritten, so the batch does not grow with repeated writes of the same node
+	b.writes = slices.DeleteFunc(b.writes, func(write pendingWrite) bool {
+		return write.offset >= offset && write.offset+int64(len(write.data)) <= end
+	})
+	b.writes = append(b.writes, pendingWrite{offset: offset, data: slices.Clone(data)})
+	b.size = max(b.size, end)
+}
+
+// overlay
+// Applies pending writes overlapping with data read from offset.
+func (b *writeBatch) overlay(data []byte, offset int64) {
+	end := offset + int64(len(data))
+	for _, write := range b.writes {
+		writeEnd := write.offset + int64(len(write.data))
+		if writeEnd <= offset || write.offset >= end {
+			continue
+		}
+		from := max(write.offset, offset)
+		to := min(writeEnd, end)
+		copy(data[from-offset:to-offset], write.data[from-write.offset:to-write.offset])
+	}
+}
+
+// readAt
+// Reads len(data) bytes from given offset including writes of the current batch.
+// If data are not fully present in file, io.EOF is returned.
+func (p *PersistentStorage[K, V]) readAt(data []byte, offset int64) error {
+	var reader io.ReaderAt = p.file
+	if p.mapping != nil {
+		reader = p.mapping
+	}
+	read, err := reader.ReadAt(data, offset)
+	if p.batch == nil {
+		if err != nil && read == len(data) && errors.Is(err, io.EOF) {
+			// read ended exactly at the end of the file
+			return nil
+		}
+		return err
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	clear(data[read:])
+	p.batch.overlay(data, offset)
+	if offset+int64(len(data)) > p.batch.size {
+		return io.EOF
+	}
+	return nil
+}
+
+// writeAt
+// Writes data to given offset. During batch, data are only stored to the batch.
+func (p *PersistentStorage[K, V]) writeAt(data []byte, offset int64) error {
+	if p.batch != nil {
+		p.batch.add(data, offset)
+		return nil
+	}
+	_, err := p.file.WriteAt(data, offset)
+	return err
+}
+
+// size
+// Returns size of the file including writes of the current batch.
+func (p *PersistentStorage[K, V]) size() (int64, error) {
+	if p.batch != nil {
+		return p.batch.size, nil
+	}
+	return p.file.Size()
+}
+
+// Begin
+// Starts atomic batch of changes. Without write-ahead log changes are written immediately and Begin does nothing.
+func (p *PersistentStorage[K, V]) Begin() error {
+	if p.log == nil {
+		return nil
+	}
+	if p.batch != nil {
+		return errors.New("batch is already in progress")
+	}
+	size, err := p.size()
+	if err != nil {
+		return err
+	}
+	p.batch = &writeBatch{
+		size:   size,
+		depth:  p.depth,
+		freeId: p.freeId,
+	}
+	return nil
+}
+
+// Commit
+// Writes changes done since Begin to the log and then to the data file. If changes could not be applied to data file,
+// they will be replayed when storage is created again.
+// Without write-ahead log, only storage with SyncEveryOperation policy is synced.
+func (p *PersistentStorage[K, V]) Commit() error {
+	if p.log == nil {
+		if p.durability != nil && p.durability.policy == SyncEveryOperation {
+			return p.Sync()
+		}
+		return nil
+	}
+	if p.batch == nil {
+		return errors.New("no batch is in progress")
+	}
+	batch := p.batch
+	p.batch = nil
+	if len(batch.writes) == 0 {
+		return nil
+	}
+	if err := p.writeLog(batch.writes); err != nil {
+		// nothing was written to the data file yet, we can safely return to the state before batch
+		p.depth, p.freeId = batch.depth, batch.freeId
+		p.chains.clear()
+		// record may be complete even if sync failed, it must not be replayed later
+		if truncateErr := p.log.Truncate(0); truncateErr != nil {
+			err = errors.Join(err, truncateErr)
+		}
+		return fmt.Errorf("could not write log: %w", err)
+	}
+	if err := p.applyLogged(batch.writes); err != nil {
+		p.chains.clear()
+		return fmt.Errorf("could not apply logged changes, storage must be recreated to replay them: %w", err)
+	}
+	return nil
+}
+
+// Rollback
+// Discards changes done since Begin. Without write-ahead log changes were already written and Rollback does nothing.
+func (p *PersistentStorage[K, V]) Rollback() error {
+	if p.log == nil {
+		return nil
+	}
+	if p.batch == nil {
+		return errors.New("no batch is in progress")
+	}
+	p.depth, p.freeId = p.batch.depth, p.batch.freeId
+	p.batch = nil
+	// chains written in batch are discarded
+	p.chains.clear()
+	return nil
+}
+
+func (p *PersistentStorage[K, V]) writeLog(writes []pendingWrite) error {
+	record := walRecordHeaderSerializer.Serialize(walRecordHeader{
+		Identifier: walIdentifier,
+		Writes:     uint32(len(writes)),
+	})
+	for _, write := range writes {
+		record = append(record, walWriteHeaderSerializer.Serialize(walWriteHeader{
+			Offset: write.offset,
+			Length: uint32(len(write.data)),
+		})...)
+		record = append(record, write.data...)
+	}
+	record = append(record, checksumSerializer.Serialize(crc32.Checksum(record, crcTable))...)
+	if _, err := p.log.WriteAt(record, 0); err != nil {
+		return err
+	}
+	return p.log.Sync()
+}
+
+func (p *PersistentStorage[K, V]) applyLogged(writes []pendingWrite) error {
+	for _, write := range writes {
+		if _, err := p.file.WriteAt(write.data, write.offset); err != nil {
+			return err
+		}
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	// log is not needed anymore, when truncation is lost, replaying it again is harmless
+	return p.log.Truncate(0)
+}
+
+// replayLog
+// Applies complete record left in log by interrupted commit. Incomplete record is discarded
+// as data file was not touched yet.
+func (p *PersistentStorage[K, V]) replayLog() error {
+	logSize, err := p.log.Size()
+	if err != nil {
+		return err
+	}
+	if logSize == 0 {
+		return nil
+	}
+	record := make([]byte, logSize)
+	if _, err := p.log.ReadAt(record, 0); err != nil {
+		return fmt.Errorf("could not read log: %w", err)
+	}
+	writes, ok := parseLogRecord(record)
+	if !ok {
+		return p.log.Truncate(0)
+	}
+	return p.applyLogged(writes)
+}
+
+func parseLogRecord(record []byte) ([]pendingWrite, bool) {
+	headerSize := int(walRecordHeaderSerializer.Size())
+	if len(record) < headerSize {
+		return nil, false
+	}
+	header := walRecordHeaderSerializer.Deserialize(record)
+	if header.Identifier != walIdentifier {
+		return nil, false
+	}
+	var (
+		offset          = headerSize
+		writeHeaderSize = int(walWriteHeaderSerializer.Size())
+		writes          = make([]pendingWrite, 0, header.Writes)
+	)
+	for i := uint32(0); i < header.Writes; i++ {
+		if len(record)-offset < writeHeaderSize {
+			return nil, false
+		}
+		writeHeader := walWriteHeaderSerializer.Deserialize(record[offset:])
+		offset += writeHeaderSize
+		if uint64(len(record)-offset) < uint64(writeHeader.Length) {
+			return nil, false
+		}
+		writes = append(writes, pendingWrite{
+			offset: writeHeader.Offset,
+			data:   record[offset : offset+int(writeHeader.Length)],
+		})
+		offset += int(writeHeader.Length)
+	}
+	if len(record)-offset < int(checksumSerializer.Size()) {
+		return nil, false
+	}
+	if checksumSerializer.Deserialize(record[offset:]) != crc32.Checksum(record[:offset], crcTable) {
+		return nil, false
+	}
+	return writes, true
+}
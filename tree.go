@@ -6,6 +6,7 @@ import (
 	"slices"
 
 	"github.com/zelezo001/eternal/encoding"
+	"github.com/zelezo001/eternal/internal/stack"
 )
 
 type NodeStorage[K cmp.Ordered, V any] interface {
@@ -35,10 +36,61 @@ type NodeStorage[K cmp.Ordered, V any] interface {
 	NewId() (uint, error)
 }
 
+// AtomicStorage
+// Can be implemented by NodeStorage, which is able to apply all changes done by one tree operation at once.
+// Tree calls Begin before its operation changes storage and Commit after the operation is done. If operation fails,
+// Rollback is called instead of Commit and storage should return to the state before Begin.
+type AtomicStorage interface {
+	Begin() error
+	Commit() error
+	Rollback() error
+}
+
+// ValueChecker
+// Can be implemented by NodeStorage, which is not able to store every value. Tree calls CheckValue before insert
+// changes storage, so value, which cannot be stored, is rejected without any change of the tree.
+type ValueChecker[K cmp.Ordered, V any] interface {
+	CheckValue(key K, value V) error
+}
+
+// DurableStorage
+// Can be implemented by NodeStorage, which does not make changes durable immediately. Sync should make all
+// changes done so far durable, see Tree.Flush.
+type DurableStorage interface {
+	Sync() error
+}
+
+// CountingStorage
+// Can be implemented by NodeStorage, which may not be able to store counts of values in subtrees of children
+// (e.g. data file of older version). Tree maintains counts (see Tree.Rank) only if CountsSubtrees returns true,
+// storage which does not implement it is expected to keep nodes as they are.
+type CountingStorage interface {
+	CountsSubtrees() bool
+}
+
+// countsSubtrees
+// Reports if storage keeps counts of values in subtrees.
+func countsSubtrees[K cmp.Ordered, V any](storage NodeStorage[K, V]) bool {
+	if counting, ok := storage.(CountingStorage); ok {
+		return counting.CountsSubtrees()
+	}
+	return true
+}
+
+// checkValue
+// Checks value by storage, if it implements ValueChecker.
+func checkValue[K cmp.Ordered, V any](storage NodeStorage[K, V], key K, value V) error {
+	if checker, ok := storage.(ValueChecker[K, V]); ok {
+		return checker.CheckValue(key, value)
+	}
+	return nil
+}
+
 type Tree[K cmp.Ordered, V any] struct {
 	a, b    uint
 	depth   uint
 	storage NodeStorage[K, V]
+	counted bool // inner nodes hold counts of values in subtrees of their children
 }
 
 func NewTree[K cmp.Ordered, V any](a, b uint, storage NodeStorage[K, V]) (*Tree[K, V], error) {
@@ -50,9 +102,24 @@ func NewTree[K cmp.Ordered, V any](a, b uint, storage NodeStorage[K, V]) (*Tree[
 		b:       b,
 		depth:   storage.GetDepth(),
 		storage: storage,
+		counted: countsSubtrees(storage),
 	}, nil
 }
 
+// ParametrizedStorage
+// NodeStorage, which knows parameters a and b of the tree it stores, e.g. from header of its file.
+type ParametrizedStorage[K cmp.Ordered, V any] interface {
+	NodeStorage[K, V]
+	Parameters() (a, b uint)
+}
+
+// NewTreeFromStorage
+// Creates tree with parameters a and b given by storage.
+func NewTreeFromStorage[K cmp.Ordered, V any](storage ParametrizedStorage[K, V]) (*Tree[K, V], error) {
+	a, b := storage.Parameters()
+	return NewTree[K, V](a, b, storage)
+}
+
 var ErrNotFound = errors.New("value not found")
 
 // Get
@@ -82,16 +149,129 @@ func (t *Tree[K, V]) Get(key K) (V, error) {
 	}
 }
 
+// atomically
+// Runs operation in batch if storage supports it.
+func (t *Tree[K, V]) atomically(operation func() error) error {
+	atomicStorage, ok := t.storage.(AtomicStorage)
+	if !ok {
+		return operation()
+	}
+	if err := atomicStorage.Begin(); err != nil {
+		return err
+	}
+	if err := operation(); err != nil {
+		if rollbackErr := atomicStorage.Rollback(); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+		// depth could be changed by the failed operation
+		t.depth = t.storage.GetDepth()
+		return err
+	}
+	if err := atomicStorage.Commit(); err != nil {
+		// storage which could not commit returns to the state before batch
+		t.depth = t.storage.GetDepth()
+		return err
+	}
+	return nil
+}
+
+// Flush
+// Makes all changes of the tree durable, if storage implements DurableStorage.
+func (t *Tree[K, V]) Flush() error {
+	if durableStorage, ok := t.storage.(DurableStorage); ok {
+		return durableStorage.Sync()
+	}
+	return nil
+}
+
 func (t *Tree[K, V]) updateDepth(depth uint) error {
 	t.depth = depth
 	return t.storage.SetDepth(depth)
 }
 
+// pathStep
+// Node visited on path from root and its position among children of the previous node.
+type pathStep struct {
+	visitedNode, positionInParent uint
+}
+
+// adjustCounts
+// Adds delta to counts of values in subtrees of nodes remaining on path. Position is position of the last popped
+// node among children of the node on top of path. Every node on path is persisted again, so counted tree writes
+// whole path on each insert and delete.
+func (t *Tree[K, V]) adjustCounts(path *stack.Stack[pathStep], position uint, delta int) error {
+	if !t.counted {
+		return nil
+	}
+	for !path.Empty() {
+		step := path.Pop()
+		node, err := t.storage.Get(step.visitedNode)
+		if err != nil {
+			return err
+		}
+		if node.counts == nil {
+			// counts are not known in this part of tree
+			return nil
+		}
+		node.counts[position] = uint(int(node.counts[position]) + delta)
+		if err := t.storage.Persist(node); err != nil {
+			return err
+		}
+		position = step.positionInParent
+	}
+	return nil
+}
+
 type Node[K cmp.Ordered, V any] struct {
 	id       uint
 	values   values[K, V]
 	children []uint
-	leaf     bool
+	// counts of values in subtrees of children, nil if they are not known
+	counts []uint
+	leaf   bool
+}
+
+// clone
+// Returns copy of node which does not share slices with original one.
+func (n Node[K, V]) clone() Node[K, V] {
+	n.values = append(make(values[K, V], 0, cap(n.values)), n.values...)
+	if n.children != nil {
+		n.children = append(make([]uint, 0, cap(n.children)), n.children...)
+	}
+	if n.counts != nil {
+		n.counts = append(make([]uint, 0, cap(n.counts)), n.counts...)
+	}
+	return n
+}
+
+// size
+// Returns number of values in subtree of node. False is returned, if counts of its children are not known.
+func (n Node[K, V]) size() (uint, bool) {
+	size := uint(len(n.values))
+	if n.leaf {
+		return size, true
+	}
+	if len(n.counts) != len(n.children) {
+		return 0, false
+	}
+	for _, count := range n.counts {
+		size += count
+	}
+	return size, true
+}
+
+// setCount
+// Stores number of values in subtree of child on given position. If it is not known, counts of node become unknown.
+func (n *Node[K, V]) setCount(position uint, child Node[K, V]) {
+	if n.counts == nil {
+		return
+	}
+	size, known := child.size()
+	if !known {
+		n.counts = nil
+		return
+	}
+	n.counts[position] = size
 }
 
 type values[K cmp.Ordered, V any] []encoding.Tuple[K, V]
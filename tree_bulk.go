@@ -0,0 +1,199 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/zelezo001/eternal/encoding"
+)
+
+var (
+	ErrUnsortedInput   = errors.New("keys of bulk loaded values must be strictly ascending")
+	ErrStorageNotEmpty = errors.New("bulk load requires empty storage")
+)
+
+// rebuildFillFactor leaves space in nodes of trees rebuilt by Recover and Migrate, so following inserts don't split
+// them immediately
+const rebuildFillFactor = 0.75
+
+// BulkLoad
+// Builds tree from values sorted by strictly ascending keys in empty storage. Nodes are filled to fillFactor
+// (from (0,1]) of their capacity and every node is persisted exactly once, level by level from leaves.
+// Bulk load is not atomic, if it fails, storage must be discarded.
+func BulkLoad[K cmp.Ordered, V any](
+	a, b uint, fillFactor float64, storage NodeStorage[K, V], seq iter.Seq2[K, V],
+) (*Tree[K, V], error) {
+	tree, err := NewTree(a, b, storage)
+	if err != nil {
+		return nil, err
+	}
+	if fillFactor <= 0 || fillFactor > 1 {
+		return nil, errors.New("fill factor must be from (0,1]")
+	}
+	root, err := storage.GetRoot()
+	if err != nil {
+		return nil, err
+	}
+	if !root.leaf || len(root.values) != 0 {
+		return nil, ErrStorageNotEmpty
+	}
+	loader := &bulkLoader[K, V]{
+		tree:   tree,
+		rootId: root.id,
+		// every node except root must have at least a-1 values
+		target: min(b-1, max(a-1, uint(math.Round(fillFactor*float64(b-1))))),
+	}
+	var (
+		previous K
+		first    = true
+	)
+	for key, value := range seq {
+		if !first && key <= previous {
+			return nil, fmt.Errorf("%w: key %v follows %v", ErrUnsortedInput, key, previous)
+		}
+		previous, first = key, false
+		if err := loader.addValue(0, encoding.Tuple[K, V]{First: key, Second: value}); err != nil {
+			return nil, err
+		}
+	}
+	if first {
+		// nothing to load, empty root is already stored
+		return tree, nil
+	}
+	if err := loader.finish(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+type bulkLoader[K cmp.Ordered, V any] struct {
+	tree   *Tree[K, V]
+	rootId uint
+	target uint
+	levels []*bulkLevel[K, V] // from leaves to the top
+}
+
+// bulkLevel
+// Nodes of one level under construction. Completed node is held until the next one is completed, so underfilled
+// last node can be balanced with it before both are persisted.
+type bulkLevel[K cmp.Ordered, V any] struct {
+	held          *Node[K, V]
+	heldSeparator encoding.Tuple[K, V] // value following held node, it goes to the parent level
+	pending       Node[K, V]
+}
+
+func (l *bulkLoader[K, V]) level(height int) *bulkLevel[K, V] {
+	if height == len(l.levels) {
+		l.levels = append(l.levels, &bulkLevel[K, V]{
+			pending: createNewNode[K, V](l.tree.b, 0, height == 0),
+		})
+	}
+	return l.levels[height]
+}
+
+func (l *bulkLoader[K, V]) addValue(height int, value encoding.Tuple[K, V]) error {
+	level := l.level(height)
+	if uint(len(level.pending.values)) < l.target {
+		level.pending.values = append(level.pending.values, value)
+		return nil
+	}
+	// pending node is complete, value separates it from the next one
+	if level.held != nil {
+		if err := l.persist(height, level.held, &level.heldSeparator); err != nil {
+			return err
+		}
+	}
+	completed := level.pending
+	level.held = &completed
+	level.heldSeparator = value
+	level.pending = createNewNode[K, V](l.tree.b, 0, height == 0)
+	return nil
+}
+
+func (l *bulkLoader[K, V]) addChild(height int, id uint, size uint) {
+	level := l.level(height)
+	level.pending.children = append(level.pending.children, id)
+	if l.tree.counted {
+		level.pending.counts = append(level.pending.counts, size)
+	}
+}
+
+// persist
+// Writes node of given level under new id and passes it to the parent level followed by separator, if there is any.
+func (l *bulkLoader[K, V]) persist(height int, node *Node[K, V], separator *encoding.Tuple[K, V]) error {
+	id, err := l.tree.storage.NewId()
+	if err != nil {
+		return err
+	}
+	node.id = id
+	if err := l.tree.storage.Persist(*node); err != nil {
+		return err
+	}
+	// all nodes are built with counts, when tree maintains them
+	size, _ := node.size()
+	l.addChild(height+1, id, size)
+	if separator == nil {
+		return nil
+	}
+	return l.addValue(height+1, *separator)
+}
+
+// finish
+// Balances the last nodes of every level and persists them, the top level node becomes root.
+func (l *bulkLoader[K, V]) finish() error {
+	for height := 0; height < len(l.levels); height++ {
+		level := l.levels[height]
+		if level.held == nil {
+			// no node of this level was completed, so there is no parent level and pending node is root
+			root := level.pending
+			root.id = l.rootId
+			if err := l.tree.storage.Persist(root); err != nil {
+				return err
+			}
+			return l.tree.updateDepth(uint(height + 1))
+		}
+		var (
+			leaf     = height == 0
+			values   = append(append(level.held.values, level.heldSeparator), level.pending.values...)
+			children = append(level.held.children, level.pending.children...)
+			counts   = append(level.held.counts, level.pending.counts...)
+		)
+		if uint(len(values)) <= l.tree.b-1 {
+			merged := Node[K, V]{values: values, children: children, counts: counts, leaf: leaf}
+			if height == len(l.levels)-1 {
+				// there is no parent level, merged node is root
+				merged.id = l.rootId
+				if err := l.tree.storage.Persist(merged); err != nil {
+					return err
+				}
+				return l.tree.updateDepth(uint(height + 1))
+			}
+			if err := l.persist(height, &merged, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		// both halves have at least (b-1)/2 >= a-1 values
+		middle := (len(values) - 1) / 2
+		// halves must not share memory, storage can keep persisted slices
+		left := Node[K, V]{values: slices.Clone(values[:middle]), leaf: leaf}
+		right := Node[K, V]{values: slices.Clone(values[middle+1:]), leaf: leaf}
+		if !leaf {
+			left.children, right.children = slices.Clone(children[:middle+1]), slices.Clone(children[middle+1:])
+		}
+		if counts != nil {
+			left.counts, right.counts = slices.Clone(counts[:middle+1]), slices.Clone(counts[middle+1:])
+		}
+		if err := l.persist(height, &left, &values[middle]); err != nil {
+			return err
+		}
+		if err := l.persist(height, &right, nil); err != nil {
+			return err
+		}
+	}
+	return errors.New("bulk load ended without root")
+}
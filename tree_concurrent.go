@@ -0,0 +1,153 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"iter"
+	"sync"
+)
+
+// ConcurrentTree
+// Wraps Tree, so it can be safely used from multiple goroutines. Reads run in parallel, writes are serialized and
+// exclude all reads. Storage must support parallel reads, which holds for both provided storages.
+type ConcurrentTree[K cmp.Ordered, V any] struct {
+	lock sync.RWMutex
+	tree *Tree[K, V]
+}
+
+func NewConcurrentTree[K cmp.Ordered, V any](a, b uint, storage NodeStorage[K, V]) (*ConcurrentTree[K, V], error) {
+	tree, err := NewTree(a, b, storage)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentTree[K, V]{tree: tree}, nil
+}
+
+// Get
+// See Tree.Get
+func (c *ConcurrentTree[K, V]) Get(key K) (V, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.Get(key)
+}
+
+// Len
+// See Tree.Len
+func (c *ConcurrentTree[K, V]) Len() (uint, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.Len()
+}
+
+// Min
+// See Tree.Min
+func (c *ConcurrentTree[K, V]) Min() (K, V, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.Min()
+}
+
+// Max
+// See Tree.Max
+func (c *ConcurrentTree[K, V]) Max() (K, V, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.Max()
+}
+
+// Rank
+// See Tree.Rank
+func (c *ConcurrentTree[K, V]) Rank(key K) (uint, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.Rank(key)
+}
+
+// At
+// See Tree.At
+func (c *ConcurrentTree[K, V]) At(index uint) (K, V, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.At(index)
+}
+
+// Insert
+// See Tree.Insert
+func (c *ConcurrentTree[K, V]) Insert(key K, value V) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.Insert(key, value)
+}
+
+// Delete
+// See Tree.Delete
+func (c *ConcurrentTree[K, V]) Delete(key K) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.Delete(key)
+}
+
+// Flush
+// See Tree.Flush
+func (c *ConcurrentTree[K, V]) Flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.Flush()
+}
+
+// Maintain
+// Runs maintenance of storage (e.g. PersistentStorage.DefragmentStep) with write lock held, so it is not interleaved
+// with any tree operation.
+func (c *ConcurrentTree[K, V]) Maintain(maintenance func() error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return maintenance()
+}
+
+// All
+// See Tree.All. Read lock is held during whole iteration, so the tree must not be modified in the loop body.
+func (c *ConcurrentTree[K, V]) All() (iter.Seq2[K, V], func() error) {
+	return c.readLocked(c.tree.All())
+}
+
+// Backward
+// See Tree.Backward. Read lock is held during whole iteration, so the tree must not be modified in the loop body.
+func (c *ConcurrentTree[K, V]) Backward() (iter.Seq2[K, V], func() error) {
+	return c.readLocked(c.tree.Backward())
+}
+
+// Range
+// See Tree.Range. Read lock is held during whole iteration, so the tree must not be modified in the loop body.
+func (c *ConcurrentTree[K, V]) Range(from, to K, options RangeOptions) (iter.Seq2[K, V], func() error) {
+	return c.readLocked(c.tree.Range(from, to, options))
+}
+
+// View
+// Runs function with read lock held. Tree passed to the function must not be modified nor used after function ends.
+// Useful for working with Cursor.
+func (c *ConcurrentTree[K, V]) View(view func(tree *Tree[K, V]) error) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return view(c.tree)
+}
+
+// Update
+// Runs function in transaction with write lock held. Transaction is committed if function returns nil,
+// otherwise it is rolled back. Function must not commit nor roll back the transaction itself.
+func (c *ConcurrentTree[K, V]) Update(update func(txn *Txn[K, V]) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	txn := c.tree.Begin()
+	if err := update(txn); err != nil {
+		return errors.Join(err, txn.Rollback())
+	}
+	return txn.Commit()
+}
+
+func (c *ConcurrentTree[K, V]) readLocked(seq iter.Seq2[K, V], err func() error) (iter.Seq2[K, V], func() error) {
+	return func(yield func(K, V) bool) {
+		c.lock.RLock()
+		defer c.lock.RUnlock()
+		seq(yield)
+	}, err
+}
@@ -0,0 +1,93 @@
+package eternal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run with -race flag to detect unsynchronized access
+func TestConcurrentTree(t *testing.T) {
+	t.Parallel()
+	const a, b = 3, 5
+	const writers, readers, operations = 2, 8, 300
+	log := createTempFile(t, "log")
+	persistent, _ := createPersistentStorage(t, a, b, WithWriteAheadLog(log))
+	storages := map[string]NodeStorage[int64, int64]{
+		"in memory":  InMemory[int64, int64](b),
+		"persistent": persistent,
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tree, err := NewConcurrentTree[int64, int64](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wait sync.WaitGroup
+			for writer := int64(0); writer < writers; writer++ {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					for i := int64(0); i < operations; i++ {
+						// every writer owns its keys
+						key := i*writers + writer
+						assert.NoError(t, tree.Insert(key, key))
+						if i%3 == 0 {
+							assert.NoError(t, tree.Delete(key))
+						}
+					}
+				}()
+			}
+			for reader := int64(0); reader < readers; reader++ {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					for i := int64(0); i < operations; i++ {
+						key := (i * 7) % (operations * writers)
+						value, err := tree.Get(key)
+						if err != nil && !errors.Is(err, ErrNotFound) {
+							t.Errorf("unexpected error: %s", err)
+						}
+						if err == nil && value != key {
+							t.Errorf("key %d has unexpected value %d", key, value)
+						}
+						if i%50 == 0 {
+							var previous int64 = -1
+							seq, iterationErr := tree.All()
+							for key := range seq {
+								if key <= previous {
+									t.Errorf("keys are not ordered")
+								}
+								previous = key
+							}
+							assert.NoError(t, iterationErr())
+						}
+					}
+				}()
+			}
+			wait.Wait()
+
+			assert.NoError(t, tree.Update(func(txn *Txn[int64, int64]) error {
+				return txn.Insert(-1, -1)
+			}))
+			assert.NoError(t, tree.View(func(tree *Tree[int64, int64]) error {
+				cursor := tree.Cursor()
+				if assert.True(t, cursor.First()) {
+					assert.Equal(t, int64(-1), cursor.Key())
+				}
+				return cursor.Err()
+			}))
+			(&treeChecker[int64, int64]{
+				testing:            t,
+				storage:            storage,
+				a:                  a,
+				b:                  b,
+				checkedNodes:       make(map[uint]struct{}),
+				expectedValueCount: writers*operations*2/3 + 1,
+			}).checkTree()
+		})
+	}
+}
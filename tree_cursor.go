@@ -0,0 +1,241 @@
+package eternal
+
+import (
+	"cmp"
+
+	"github.com/zelezo001/eternal/internal/stack"
+)
+
+// Cursor
+// Stateful iterator over tree, which can move in both directions and can be repositioned by Seek.
+// Cursor remembers path from root to the current value, so moving to neighbouring value rarely requires loading more
+// than one node. Nodes on the path are held by cursor, any modification of the tree invalidates it and cursor must be
+// repositioned by First, Last or Seek before further use.
+type Cursor[K cmp.Ordered, V any] struct {
+	tree *Tree[K, V]
+	// for the top of the path, position is index of the current value
+	// for other nodes it is index of the child, which is next on the path
+	path  *stack.Stack[cursorStep[K, V]]
+	valid bool
+	err   error
+}
+
+type cursorStep[K cmp.Ordered, V any] struct {
+	node     Node[K, V]
+	position int
+}
+
+// Cursor
+// Returns new cursor over tree. Cursor is not positioned, call First, Last or Seek before reading from it.
+func (t *Tree[K, V]) Cursor() *Cursor[K, V] {
+	return &Cursor[K, V]{
+		tree: t,
+		path: stack.NewStack[cursorStep[K, V]](t.depth),
+	}
+}
+
+// Valid
+// Returns true if cursor points to a stored value.
+func (c *Cursor[K, V]) Valid() bool {
+	return c.valid
+}
+
+// Err
+// Returns error which invalidated cursor, nil if cursor was invalidated by reaching end of the tree.
+func (c *Cursor[K, V]) Err() error {
+	return c.err
+}
+
+// Key
+// Returns key of the current value. Must be called only on valid cursor.
+func (c *Cursor[K, V]) Key() K {
+	current := c.path.Peek()
+	return current.node.values[current.position].First
+}
+
+// Value
+// Returns current value. Must be called only on valid cursor.
+func (c *Cursor[K, V]) Value() V {
+	current := c.path.Peek()
+	return current.node.values[current.position].Second
+}
+
+// First
+// Moves cursor to the value with the smallest key. Returns false if the tree is empty or error occurred.
+func (c *Cursor[K, V]) First() bool {
+	root, ok := c.reset()
+	if !ok {
+		return false
+	}
+	return c.descendLeftmost(root)
+}
+
+// Last
+// Moves cursor to the value with the greatest key. Returns false if the tree is empty or error occurred.
+func (c *Cursor[K, V]) Last() bool {
+	root, ok := c.reset()
+	if !ok {
+		return false
+	}
+	return c.descendRightmost(root)
+}
+
+// Seek
+// Moves cursor to the value with the smallest key greater or equal to given key.
+// Returns false if there is no such value or error occurred.
+func (c *Cursor[K, V]) Seek(key K) bool {
+	currentNode, ok := c.reset()
+	if !ok {
+		return false
+	}
+	for {
+		found, position, _ := currentNode.values.find(key)
+		c.path.Push(cursorStep[K, V]{node: currentNode, position: position})
+		if found {
+			c.valid = true
+			return true
+		}
+		if currentNode.leaf {
+			if position < len(currentNode.values) {
+				c.valid = true
+				return true
+			}
+			// all values in leaf are lesser than key, successor is in one of the ancestors
+			return c.ascendForward()
+		}
+		// presence of position is guarantied by nature of (a,b)-tree
+		var err error
+		currentNode, err = c.tree.storage.Get(currentNode.children[position])
+		if err != nil {
+			return c.fail(err)
+		}
+	}
+}
+
+// Next
+// Moves cursor to the following value. Returns false if there is no such value or error occurred.
+func (c *Cursor[K, V]) Next() bool {
+	if !c.valid {
+		return false
+	}
+	current := c.path.Peek()
+	if current.node.leaf {
+		if current.position+1 < len(current.node.values) {
+			current.position++
+			return true
+		}
+		return c.ascendForward()
+	}
+	// successor is the smallest value in the right subtree
+	current.position++
+	child, err := c.tree.storage.Get(current.node.children[current.position])
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.descendLeftmost(child)
+}
+
+// Prev
+// Moves cursor to the preceding value. Returns false if there is no such value or error occurred.
+func (c *Cursor[K, V]) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	current := c.path.Peek()
+	if current.node.leaf {
+		if current.position > 0 {
+			current.position--
+			return true
+		}
+		return c.ascendBackward()
+	}
+	// predecessor is the greatest value in the left subtree, position of the value is equal to index of the subtree
+	child, err := c.tree.storage.Get(current.node.children[current.position])
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.descendRightmost(child)
+}
+
+func (c *Cursor[K, V]) reset() (Node[K, V], bool) {
+	c.path.Clear()
+	c.valid = false
+	c.err = nil
+	root, err := c.tree.storage.GetRoot()
+	if err != nil {
+		return root, c.fail(err)
+	}
+	return root, true
+}
+
+func (c *Cursor[K, V]) fail(err error) bool {
+	c.path.Clear()
+	c.valid = false
+	c.err = err
+	return false
+}
+
+func (c *Cursor[K, V]) descendLeftmost(node Node[K, V]) bool {
+	for !node.leaf {
+		c.path.Push(cursorStep[K, V]{node: node, position: 0})
+		var err error
+		node, err = c.tree.storage.Get(node.children[0])
+		if err != nil {
+			return c.fail(err)
+		}
+	}
+	c.path.Push(cursorStep[K, V]{node: node, position: 0})
+	// only root can be leaf without values
+	c.valid = len(node.values) > 0
+	return c.valid
+}
+
+func (c *Cursor[K, V]) descendRightmost(node Node[K, V]) bool {
+	for !node.leaf {
+		c.path.Push(cursorStep[K, V]{node: node, position: len(node.children) - 1})
+		var err error
+		node, err = c.tree.storage.Get(node.children[len(node.children)-1])
+		if err != nil {
+			return c.fail(err)
+		}
+	}
+	c.path.Push(cursorStep[K, V]{node: node, position: len(node.values) - 1})
+	// only root can be leaf without values
+	c.valid = len(node.values) > 0
+	return c.valid
+}
+
+// ascendForward
+// Pops exhausted nodes from path until ancestor with value following the visited subtree is found.
+func (c *Cursor[K, V]) ascendForward() bool {
+	c.path.Pop()
+	for !c.path.Empty() {
+		current := c.path.Peek()
+		// value following child on position i has also index i
+		if current.position < len(current.node.values) {
+			c.valid = true
+			return true
+		}
+		c.path.Pop()
+	}
+	c.valid = false
+	return false
+}
+
+// ascendBackward
+// Pops exhausted nodes from path until ancestor with value preceding the visited subtree is found.
+func (c *Cursor[K, V]) ascendBackward() bool {
+	c.path.Pop()
+	for !c.path.Empty() {
+		current := c.path.Peek()
+		// value preceding child on position i has index i-1
+		if current.position > 0 {
+			current.position--
+			c.valid = true
+			return true
+		}
+		c.path.Pop()
+	}
+	c.valid = false
+	return false
+}
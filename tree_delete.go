@@ -5,8 +5,16 @@ import (
 	"github.com/zelezo001/eternal/internal/stack"
 )
 
+// Delete
+// Removes value stored under given key. Deleting key, which is not present, is not an error.
 func (t *Tree[K, V]) Delete(key K) error {
-	path := stack.NewStack[deleteStep](t.depth)
+	return t.atomically(func() error {
+		return t.delete(key)
+	})
+}
+
+func (t *Tree[K, V]) delete(key K) error {
+	path := stack.NewStack[pathStep](t.depth)
 	root, err := t.storage.GetRoot()
 	if err != nil {
 		return err
@@ -14,7 +22,7 @@ func (t *Tree[K, V]) Delete(key K) error {
 	currentNode := root
 	var positionInParent uint
 	for {
-		path.Push(deleteStep{currentNode.id, positionInParent})
+		path.Push(pathStep{currentNode.id, positionInParent})
 		found, position, _ := currentNode.values.find(key)
 		if found {
 			if currentNode.leaf {
@@ -33,6 +41,9 @@ func (t *Tree[K, V]) Delete(key K) error {
 					return err
 				}
 				currentNode.values[position] = valueToReplace
+				if err := t.storage.Persist(currentNode); err != nil {
+					return err
+				}
 				break
 			}
 		}
@@ -53,7 +64,7 @@ func (t *Tree[K, V]) Delete(key K) error {
 }
 
 func (t *Tree[K, V]) popLargest(
-	visitedNodes *stack.Stack[deleteStep], nodeId uint, positionInParent uint,
+	visitedNodes *stack.Stack[pathStep], nodeId uint, positionInParent uint,
 ) (encoding.Tuple[K, V], error) {
 	var (
 		currentNode Node[K, V]
@@ -64,7 +75,7 @@ func (t *Tree[K, V]) popLargest(
 		if err != nil {
 			return encoding.Tuple[K, V]{}, err
 		}
-		visitedNodes.Push(deleteStep{currentNode.id, positionInParent})
+		visitedNodes.Push(pathStep{currentNode.id, positionInParent})
 		if currentNode.leaf {
 			break
 		}
@@ -87,6 +98,15 @@ func (t *Tree[K, V]) merge(
 	middleValue, parent.values = pop(parent.values, middleValuePosition)
 	left.values = append(append(left.values, middleValue), right.values...)
 	left.children = append(left.children, right.children...)
+	if left.counts != nil && right.counts != nil {
+		left.counts = append(left.counts, right.counts...)
+	} else {
+		left.counts = nil
+	}
+	if parent.counts != nil {
+		_, parent.counts = pop(parent.counts, middleValuePosition+1)
+		parent.setCount(middleValuePosition, left)
+	}
 	if parentIsRoot && len(parent.values) == 0 {
 		// parent is root with no stored value, left is the new root
 		err := t.storage.Remove(left.id)
@@ -110,11 +130,7 @@ func (t *Tree[K, V]) merge(
 	return t.storage.Persist(left)
 }
 
-type deleteStep struct {
-	visitedNode, positionInParent uint
-}
-
-func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[deleteStep]) error {
+func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[pathStep]) error {
 	if path.Count() <= 1 {
 		// we don't need to balance tree with only root node
 		return nil
@@ -126,8 +142,8 @@ func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[deleteStep]) error
 	}
 	for {
 		if uint(len(node.values))+1 >= t.a {
-			//node does not need to be fixed, we can stop back tracing
-			return nil
+			//node does not need to be fixed, we can stop back tracing, only counts above are updated
+			return t.adjustCounts(path, toCheck.positionInParent, -1)
 		}
 
 		parentStep := path.Pop()
@@ -156,7 +172,10 @@ func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[deleteStep]) error
 				if !node.leaf {
 					childFromSibling, sibling.children = popFirst(sibling.children)
 					node.children = append(node.children, childFromSibling)
+					node.counts, sibling.counts = moveCount(sibling.counts, node.counts, true)
 				}
+				parent.setCount(toCheck.positionInParent, node)
+				parent.setCount(rightSiblingPosition, sibling)
 				if err := persistMultiple(t.storage, sibling, parent, node); err != nil {
 					return err
 				}
@@ -183,7 +202,10 @@ func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[deleteStep]) error
 					var childFromSibling uint
 					childFromSibling, sibling.children = popLast(sibling.children)
 					node.children = prepend(node.children, childFromSibling)
+					node.counts, sibling.counts = moveCount(sibling.counts, node.counts, false)
 				}
+				parent.setCount(leftSiblingPosition, sibling)
+				parent.setCount(toCheck.positionInParent, node)
 				if err := persistMultiple(t.storage, sibling, parent, node); err != nil {
 					return err
 				}
@@ -202,3 +224,19 @@ func (t *Tree[K, V]) balanceTreeAfterDelete(path *stack.Stack[deleteStep]) error
 		}
 	}
 }
+
+// moveCount
+// Moves count of child borrowed from sibling, the first count of right sibling or the last count of left sibling.
+// Returns counts of node and sibling, both are nil if any of them is not known.
+func moveCount(from, to []uint, fromRight bool) ([]uint, []uint) {
+	if from == nil || to == nil {
+		return nil, nil
+	}
+	var count uint
+	if fromRight {
+		count, from = popFirst(from)
+		return append(to, count), from
+	}
+	count, from = popLast(from)
+	return prepend(to, count), from
+}
@@ -2,19 +2,35 @@ package eternal
 
 import (
 	"cmp"
+	"slices"
 
 	"github.com/zelezo001/eternal/encoding"
 	"github.com/zelezo001/eternal/internal/stack"
 )
 
+// Insert
+// Stores value under given key. If key is already present, its value is replaced.
+// If storage implements ValueChecker and rejects the value, error is returned and the tree is not changed.
 func (t *Tree[K, V]) Insert(key K, value V) error {
+	return t.atomically(func() error {
+		return t.insert(key, value)
+	})
+}
+
+func (t *Tree[K, V]) insert(key K, value V) error {
+	if err := checkValue(t.storage, key, value); err != nil {
+		return err
+	}
 	// path to leaf is always t.depth nodes and the last node is stored in currentNode
-	path := stack.NewStack[uint](t.depth - 1)
+	path := stack.NewStack[pathStep](t.depth - 1)
 	root, err := t.storage.GetRoot()
 	if err != nil {
 		return err
 	}
-	var currentNode = root
+	var (
+		currentNode      = root
+		positionInParent uint
+	)
 	for {
 		found, position, _ := currentNode.values.find(key)
 		if found {
@@ -27,7 +43,8 @@ func (t *Tree[K, V]) Insert(key K, value V) error {
 			currentNode.values.add(encoding.Tuple[K, V]{First: key, Second: value})
 			break
 		}
-		path.Push(currentNode.id)
+		path.Push(pathStep{currentNode.id, positionInParent})
+		positionInParent = uint(position)
 		// presence of position is guarantied by nature of (a,b)-tree
 		var nextNodeId = currentNode.children[position]
 		currentNode, err = t.storage.Get(nextNodeId)
@@ -40,7 +57,11 @@ func (t *Tree[K, V]) Insert(key K, value V) error {
 		if currentNode.values.count() < t.b {
 			// currentNode is either node with new value or parent from previous iteration.
 			//In both scenarios, we need to persist it.
-			return t.storage.Persist(currentNode)
+			if err := t.storage.Persist(currentNode); err != nil {
+				return err
+			}
+			// subtrees of nodes above contain one more value
+			return t.adjustCounts(path, positionInParent, 1)
 		}
 		if path.Empty() {
 			// currentNode is root
@@ -57,6 +78,11 @@ func (t *Tree[K, V]) Insert(key K, value V) error {
 			newRoot := createNewNode[K, V](t.b, oldRoot.id, false)
 			newRoot.values.add(middle)
 			newRoot.children = append(newRoot.children, newNode.id, oldRootNewId)
+			if t.counted {
+				newRoot.counts = make([]uint, 2, t.b+1)
+				newRoot.setCount(0, newNode)
+				newRoot.setCount(1, oldRoot)
+			}
 			oldRoot.id = oldRootNewId
 
 			if err := persistMultiple(t.storage, newRoot, oldRoot, newNode); err != nil {
@@ -64,7 +90,8 @@ func (t *Tree[K, V]) Insert(key K, value V) error {
 			}
 			return t.updateDepth(t.depth + 1)
 		} else {
-			parent, err := t.storage.Get(path.Pop())
+			parentStep := path.Pop()
+			parent, err := t.storage.Get(parentStep.visitedNode)
 			if err != nil {
 				return err
 			}
@@ -76,11 +103,18 @@ func (t *Tree[K, V]) Insert(key K, value V) error {
 			newNode, middle, oldNode := t.splitFullNode(newNodeId, currentNode)
 			parent.children = prependBefore(parent.children, newNode.id, oldNode.id)
 			parent.values.add(middle)
+			if parent.counts != nil {
+				// new node precedes old one
+				parent.counts = slices.Insert(parent.counts, int(positionInParent), 0)
+				parent.setCount(positionInParent, newNode)
+				parent.setCount(positionInParent+1, oldNode)
+			}
 			if err := persistMultiple(t.storage, oldNode, newNode); err != nil {
 				return err
 			}
 
 			currentNode = parent
+			positionInParent = parentStep.positionInParent
 		}
 	}
 
@@ -109,12 +143,21 @@ func (t *Tree[K, V]) splitFullNode(newNodeId uint, currentNode Node[K, V]) (
 			newNode.children = append(newNode.children, currentNode.children[i])
 			currentNode.children[i] = currentNode.children[1+i+middleIndex]
 		}
+		if currentNode.counts != nil {
+			newNode.counts = append(newNode.counts, currentNode.counts[i])
+			currentNode.counts[i] = currentNode.counts[1+i+middleIndex]
+		}
 	}
 	if !currentNode.leaf {
 		newNode.children = append(newNode.children, currentNode.children[middleIndex])
 		currentNode.children[middleIndex] = currentNode.children[t.b]
 		currentNode.children = currentNode.children[:middleIndex+1]
 	}
+	if currentNode.counts != nil {
+		newNode.counts = append(newNode.counts, currentNode.counts[middleIndex])
+		currentNode.counts[middleIndex] = currentNode.counts[t.b]
+		currentNode.counts = currentNode.counts[:middleIndex+1]
+	}
 	currentNode.values = currentNode.values[:middleIndex]
 
 	return newNode, middle, currentNode
@@ -0,0 +1,171 @@
+package eternal
+
+import "errors"
+
+var ErrIndexOutOfRange = errors.New("index is out of range")
+
+// Len
+// Returns number of stored values. It is read from root, when tree maintains counts of values in subtrees
+// (see CountingStorage), otherwise all values are scanned.
+func (t *Tree[K, V]) Len() (uint, error) {
+	root, err := t.storage.GetRoot()
+	if err != nil {
+		return 0, err
+	}
+	if size, known := root.size(); known {
+		return size, nil
+	}
+	var count uint
+	all, finish := t.All()
+	for range all {
+		count++
+	}
+	return count, finish()
+}
+
+// Min
+// Returns key and value with the smallest key. If tree is empty, ErrNotFound is returned.
+func (t *Tree[K, V]) Min() (K, V, error) {
+	return t.edge(true)
+}
+
+// Max
+// Returns key and value with the greatest key. If tree is empty, ErrNotFound is returned.
+func (t *Tree[K, V]) Max() (K, V, error) {
+	return t.edge(false)
+}
+
+// edge
+// Descends to the leftmost or rightmost leaf and returns its first or last value.
+func (t *Tree[K, V]) edge(first bool) (K, V, error) {
+	var (
+		emptyKey   K
+		emptyValue V
+	)
+	node, err := t.storage.GetRoot()
+	if err != nil {
+		return emptyKey, emptyValue, err
+	}
+	for !node.leaf {
+		position := 0
+		if !first {
+			position = len(node.children) - 1
+		}
+		if node, err = t.storage.Get(node.children[position]); err != nil {
+			return emptyKey, emptyValue, err
+		}
+	}
+	if len(node.values) == 0 {
+		// only root leaf can be empty
+		return emptyKey, emptyValue, ErrNotFound
+	}
+	value := node.values[0]
+	if !first {
+		value = node.values[len(node.values)-1]
+	}
+	return value.First, value.Second, nil
+}
+
+// Rank
+// Returns number of stored keys lesser than key, key itself does not have to be stored. Only one path from root
+// is visited, when tree maintains counts of values in subtrees, otherwise lesser keys are scanned.
+func (t *Tree[K, V]) Rank(key K) (uint, error) {
+	node, err := t.storage.GetRoot()
+	if err != nil {
+		return 0, err
+	}
+	var rank uint
+	for {
+		found, position, _ := node.values.find(key)
+		if node.leaf {
+			return rank + uint(position), nil
+		}
+		if len(node.counts) != len(node.children) {
+			return t.scanRank(key)
+		}
+		// values and subtrees on the left of position are lesser
+		rank += uint(position)
+		for _, count := range node.counts[:position] {
+			rank += count
+		}
+		if found {
+			return rank + node.counts[position], nil
+		}
+		if node, err = t.storage.Get(node.children[position]); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (t *Tree[K, V]) scanRank(key K) (uint, error) {
+	var rank uint
+	all, finish := t.All()
+	for stored := range all {
+		if stored >= key {
+			break
+		}
+		rank++
+	}
+	return rank, finish()
+}
+
+// At
+// Returns key and value on given position in ascending key order, position of the smallest key is 0.
+// If there is no such position, ErrIndexOutOfRange is returned. See Rank for cost.
+func (t *Tree[K, V]) At(index uint) (K, V, error) {
+	var (
+		emptyKey   K
+		emptyValue V
+	)
+	node, err := t.storage.GetRoot()
+	if err != nil {
+		return emptyKey, emptyValue, err
+	}
+	for !node.leaf {
+		if len(node.counts) != len(node.children) {
+			return t.scanAt(index)
+		}
+		position := 0
+		// skip subtrees and values before index, value following subtree is on the position after it
+		for ; position < len(node.children) && index >= node.counts[position]; position++ {
+			index -= node.counts[position]
+			if position < len(node.values) {
+				if index == 0 {
+					value := node.values[position]
+					return value.First, value.Second, nil
+				}
+				index--
+			}
+		}
+		if position == len(node.children) {
+			return emptyKey, emptyValue, ErrIndexOutOfRange
+		}
+		if node, err = t.storage.Get(node.children[position]); err != nil {
+			return emptyKey, emptyValue, err
+		}
+	}
+	if index >= uint(len(node.values)) {
+		return emptyKey, emptyValue, ErrIndexOutOfRange
+	}
+	value := node.values[index]
+	return value.First, value.Second, nil
+}
+
+func (t *Tree[K, V]) scanAt(index uint) (K, V, error) {
+	var position uint
+	all, finish := t.All()
+	for key, value := range all {
+		if position == index {
+			return key, value, finish()
+		}
+		position++
+	}
+	var (
+		emptyKey   K
+		emptyValue V
+	)
+	if err := finish(); err != nil {
+		return emptyKey, emptyValue, err
+	}
+	return emptyKey, emptyValue, ErrIndexOutOfRange
+}
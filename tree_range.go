@@ -0,0 +1,173 @@
+package eternal
+
+import (
+	"cmp"
+	"iter"
+)
+
+// RangeOptions
+// Configures behaviour of Tree.Range. Zero value represents inclusive range iterated in ascending order.
+type RangeOptions struct {
+	// ExcludeFrom removes key equal to lower bound from the range
+	ExcludeFrom bool
+	// ExcludeTo removes key equal to upper bound from the range
+	ExcludeTo bool
+	// Reverse iterates from the greatest key to the smallest one
+	Reverse bool
+}
+
+type keyRange[K cmp.Ordered] struct {
+	from, to               K
+	hasFrom, hasTo         bool
+	excludeFrom, excludeTo bool
+}
+
+// afterFrom
+// Returns true if key respects lower bound of the range.
+func (r keyRange[K]) afterFrom(key K) bool {
+	if !r.hasFrom {
+		return true
+	}
+	if r.excludeFrom {
+		return key > r.from
+	}
+	return key >= r.from
+}
+
+// beforeTo
+// Returns true if key respects upper bound of the range.
+func (r keyRange[K]) beforeTo(key K) bool {
+	if !r.hasTo {
+		return true
+	}
+	if r.excludeTo {
+		return key < r.to
+	}
+	return key <= r.to
+}
+
+// All
+// Returns iterator over all stored key-value pairs in ascending key order. Error function must be checked after
+// iterating, see Range.
+func (t *Tree[K, V]) All() (iter.Seq2[K, V], func() error) {
+	return t.scan(keyRange[K]{}, false)
+}
+
+// Backward
+// Returns iterator over all stored key-value pairs in descending key order. Error function must be checked after
+// iterating, see Range.
+func (t *Tree[K, V]) Backward() (iter.Seq2[K, V], func() error) {
+	return t.scan(keyRange[K]{}, true)
+}
+
+// Range
+// Returns iterator over key-value pairs with keys between from and to. Bounds are inclusive unless configured
+// otherwise by options. Iterator stops at the first error returned from storage without reporting it to the loop,
+// so iteration ended by error looks like complete one. Callers must check the returned function once iteration ends,
+// it returns the error or nil. Tree must not be modified during iteration.
+func (t *Tree[K, V]) Range(from, to K, options RangeOptions) (iter.Seq2[K, V], func() error) {
+	return t.scan(keyRange[K]{
+		from:        from,
+		to:          to,
+		hasFrom:     true,
+		hasTo:       true,
+		excludeFrom: options.ExcludeFrom,
+		excludeTo:   options.ExcludeTo,
+	}, options.Reverse)
+}
+
+func (t *Tree[K, V]) scan(bounds keyRange[K], reverse bool) (iter.Seq2[K, V], func() error) {
+	var err error
+	return func(yield func(K, V) bool) {
+			err = nil
+			root, rootErr := t.storage.GetRoot()
+			if rootErr != nil {
+				err = rootErr
+				return
+			}
+			if reverse {
+				_, err = t.walkBackward(root, bounds, yield)
+			} else {
+				_, err = t.walkForward(root, bounds, yield)
+			}
+		}, func() error {
+			return err
+		}
+}
+
+// walkForward
+// Yields values from subtree of node in ascending order. Returned bool indicates if iteration should continue.
+func (t *Tree[K, V]) walkForward(node Node[K, V], bounds keyRange[K], yield func(K, V) bool) (bool, error) {
+	var (
+		start     int
+		fromFound bool
+	)
+	if bounds.hasFrom {
+		// children before start contain only keys lesser than from
+		fromFound, start, _ = node.values.find(bounds.from)
+	}
+	for i := start; i <= len(node.values); i++ {
+		// if from is stored in node, child on its left side contains only lesser keys
+		if !node.leaf && !(fromFound && i == start) {
+			child, err := t.storage.Get(node.children[i])
+			if err != nil {
+				return false, err
+			}
+			next, err := t.walkForward(child, bounds, yield)
+			if !next || err != nil {
+				return false, err
+			}
+		}
+		if i == len(node.values) {
+			break
+		}
+		value := node.values[i]
+		if !bounds.afterFrom(value.First) {
+			continue
+		}
+		if !bounds.beforeTo(value.First) || !yield(value.First, value.Second) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// walkBackward
+// Yields values from subtree of node in descending order. Returned bool indicates if iteration should continue.
+func (t *Tree[K, V]) walkBackward(node Node[K, V], bounds keyRange[K], yield func(K, V) bool) (bool, error) {
+	var (
+		end     = len(node.values)
+		toFound bool
+	)
+	if bounds.hasTo {
+		// children after end contain only keys greater than to
+		toFound, end, _ = node.values.find(bounds.to)
+		if toFound {
+			end++
+		}
+	}
+	for i := end; i >= 0; i-- {
+		// if to is stored in node, child on its right side contains only greater keys
+		if !node.leaf && !(toFound && i == end) {
+			child, err := t.storage.Get(node.children[i])
+			if err != nil {
+				return false, err
+			}
+			next, err := t.walkBackward(child, bounds, yield)
+			if !next || err != nil {
+				return false, err
+			}
+		}
+		if i == 0 {
+			break
+		}
+		value := node.values[i-1]
+		if !bounds.beforeTo(value.First) {
+			continue
+		}
+		if !bounds.afterFrom(value.First) || !yield(value.First, value.Second) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
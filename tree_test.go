@@ -2,6 +2,10 @@ package eternal
 
 import (
 	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
 	"slices"
 	"testing"
 
@@ -251,3 +255,645 @@ func (t *treeChecker[K, V]) checkNode(nodeId, depth uint, min, max *K) {
 		t.checkNode(child, depth+1, childMin, childMax)
 	}
 }
+
+func TestTree_Range(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 2, 3
+	tree, _ := createTreeWithInMemoryStorage[int, int](a, b)
+	var keys []int
+	for i := 0; i < 200; i += 2 {
+		keys = append(keys, i)
+		if err := tree.Insert(i, i*10); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	collect := func(t *testing.T, seq iter.Seq2[int, int], err func() error) []int {
+		t.Helper()
+		var collected []int
+		for key, value := range seq {
+			if value != key*10 {
+				t.Fatalf("unexpected value %d for key %d", value, key)
+			}
+			collected = append(collected, key)
+		}
+		if err() != nil {
+			t.Fatalf("iteration failed: %s", err())
+		}
+		return collected
+	}
+	reversed := slices.Clone(keys)
+	slices.Reverse(reversed)
+
+	seq, err := tree.All()
+	assert.Equal(t, keys, collect(t, seq, err))
+	seq, err = tree.Backward()
+	assert.Equal(t, reversed, collect(t, seq, err))
+
+	type Scenario struct {
+		From, To int
+		Options  RangeOptions
+		Expected []int
+	}
+	scenarios := []Scenario{
+		{From: 10, To: 20, Expected: []int{10, 12, 14, 16, 18, 20}},
+		{From: 9, To: 21, Expected: []int{10, 12, 14, 16, 18, 20}},
+		{From: 10, To: 20, Options: RangeOptions{ExcludeFrom: true, ExcludeTo: true}, Expected: []int{12, 14, 16, 18}},
+		{From: 10, To: 20, Options: RangeOptions{Reverse: true}, Expected: []int{20, 18, 16, 14, 12, 10}},
+		{
+			From: 10, To: 20, Options: RangeOptions{Reverse: true, ExcludeFrom: true, ExcludeTo: true},
+			Expected: []int{18, 16, 14, 12},
+		},
+		{From: -100, To: 4, Expected: []int{0, 2, 4}},
+		{From: 195, To: 1000, Options: RangeOptions{Reverse: true}, Expected: []int{198, 196}},
+		{From: 20, To: 10, Expected: nil},
+		{From: 11, To: 11, Expected: nil},
+	}
+	for _, scenario := range scenarios {
+		t.Run("", func(t *testing.T) {
+			seq, err := tree.Range(scenario.From, scenario.To, scenario.Options)
+			assert.Equal(t, scenario.Expected, collect(t, seq, err))
+		})
+	}
+
+	// iteration can be stopped early
+	seq, _ = tree.All()
+	var visited int
+	for range seq {
+		visited++
+		if visited == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, visited)
+}
+
+func TestTree_Cursor(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 3, 5
+	tree, _ := createTreeWithInMemoryStorage[int, int](a, b)
+	cursor := tree.Cursor()
+	assert.False(t, cursor.First())
+	assert.False(t, cursor.Last())
+	assert.False(t, cursor.Seek(10))
+
+	var keys []int
+	for i := 0; i < 500; i += 5 {
+		keys = append(keys, i)
+		if err := tree.Insert(i, -i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+
+	var forward []int
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		assert.Equal(t, -cursor.Key(), cursor.Value())
+		forward = append(forward, cursor.Key())
+	}
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, keys, forward)
+
+	var backward []int
+	for ok := cursor.Last(); ok; ok = cursor.Prev() {
+		backward = append(backward, cursor.Key())
+	}
+	assert.NoError(t, cursor.Err())
+	slices.Reverse(backward)
+	assert.Equal(t, keys, backward)
+
+	if assert.True(t, cursor.Seek(100)) {
+		assert.Equal(t, 100, cursor.Key())
+	}
+	if assert.True(t, cursor.Seek(101)) {
+		assert.Equal(t, 105, cursor.Key())
+	}
+	// changing direction returns back to already visited values
+	for _, expected := range []int{110, 115, 110, 105, 100} {
+		var ok bool
+		if expected > cursor.Key() {
+			ok = cursor.Next()
+		} else {
+			ok = cursor.Prev()
+		}
+		if assert.True(t, ok) {
+			assert.Equal(t, expected, cursor.Key())
+		}
+	}
+	assert.False(t, cursor.Seek(496))
+	assert.True(t, cursor.Seek(-10))
+	assert.Equal(t, 0, cursor.Key())
+	assert.False(t, cursor.Prev())
+	assert.False(t, cursor.Valid())
+}
+
+func TestTree_Txn(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 2, 3
+	tree, storage := createTreeWithInMemoryStorage[int, int](a, b)
+	for i := 0; i < 30; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	snapshot := func() map[int]int {
+		values := make(map[int]int)
+		seq, err := tree.All()
+		for key, value := range seq {
+			values[key] = value
+		}
+		assert.NoError(t, err())
+		return values
+	}
+	original := snapshot()
+
+	txn := tree.Begin()
+	for i := 0; i < 30; i += 2 {
+		assert.NoError(t, txn.Delete(i))
+	}
+	for i := 100; i < 130; i++ {
+		assert.NoError(t, txn.Insert(i, -i))
+	}
+	value, err := txn.Get(101)
+	assert.NoError(t, err)
+	assert.Equal(t, -101, value)
+	_, err = txn.Get(2)
+	assert.ErrorIs(t, err, ErrNotFound)
+	// changes are not visible outside of transaction
+	assert.Equal(t, original, snapshot())
+	assert.NoError(t, txn.Rollback())
+	assert.Equal(t, original, snapshot())
+	assert.ErrorIs(t, txn.Insert(1, 1), ErrTxnDone)
+
+	txn = tree.Begin()
+	expected := maps.Clone(original)
+	for i := 0; i < 30; i += 2 {
+		assert.NoError(t, txn.Delete(i))
+		delete(expected, i)
+	}
+	for i := 100; i < 130; i++ {
+		assert.NoError(t, txn.Insert(i, -i))
+		expected[i] = -i
+	}
+	assert.NoError(t, txn.Commit())
+	assert.ErrorIs(t, txn.Commit(), ErrTxnDone)
+	assert.Equal(t, expected, snapshot())
+	assert.Equal(t, storage.GetDepth(), tree.depth)
+	checker := &treeChecker[int, int]{
+		testing:            t,
+		storage:            storage,
+		a:                  a,
+		b:                  b,
+		checkedNodes:       make(map[uint]struct{}),
+		expectedValueCount: len(expected),
+	}
+	checker.checkTree()
+	assert.Equal(t, len(checker.checkedNodes), len(storage.nodes))
+}
+
+func TestTree_TxnDeleteInnerValue(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 2, 3
+	tree, storage := createTreeWithInMemoryStorage[int, int](a, b)
+	for i := 0; i < 30; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	// key stored in root is replaced by its predecessor, which must reach the overlay
+	deleted := storage.nodes[rootId].values[0].First
+	txn := tree.Begin()
+	assert.NoError(t, txn.Delete(deleted))
+	for i := 0; i < 30; i++ {
+		_, err := txn.Get(i)
+		if i == deleted {
+			assert.ErrorIs(t, err, ErrNotFound)
+		} else {
+			assert.NoError(t, err, "key %d", i)
+		}
+	}
+	assert.NoError(t, txn.Commit())
+	for i := 0; i < 30; i++ {
+		value, err := tree.Get(i)
+		if i == deleted {
+			assert.ErrorIs(t, err, ErrNotFound)
+		} else if assert.NoError(t, err, "key %d", i) {
+			assert.Equal(t, i, value)
+		}
+	}
+	(&treeChecker[int, int]{
+		testing:            t,
+		storage:            storage,
+		a:                  a,
+		b:                  b,
+		checkedNodes:       make(map[uint]struct{}),
+		expectedValueCount: 29,
+	}).checkTree()
+}
+
+// failingStorage
+// Fails loading of node with given id, once failing is set, and rejects negative values.
+type failingStorage struct {
+	NodeStorage[int, int]
+	failId  uint
+	failing bool
+}
+
+var errFailingStorage = errors.New("node cannot be loaded")
+
+func (f *failingStorage) Get(id uint) (Node[int, int], error) {
+	if f.failing && id == f.failId {
+		return Node[int, int]{}, errFailingStorage
+	}
+	return f.NodeStorage.Get(id)
+}
+
+func (f *failingStorage) CheckValue(_ int, value int) error {
+	if value < 0 {
+		return errors.New("negative value")
+	}
+	return nil
+}
+
+func TestTree_TxnFailed(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 2, 3
+	inMemory := InMemory[int, int](b)
+	storage := &failingStorage{NodeStorage: inMemory}
+	tree, err := NewTree[int, int](a, b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := tree.Insert(i, i); err != nil {
+			t.Fatalf("failed inserting value: %s", err)
+		}
+	}
+	node := inMemory.nodes[rootId]
+	for !node.leaf {
+		node = inMemory.nodes[node.children[0]]
+	}
+	storage.failId = node.id
+
+	txn := tree.Begin()
+	for i := 100; i < 110; i++ {
+		assert.NoError(t, txn.Insert(i, i))
+	}
+	// rejected value does not change the transaction
+	assert.Error(t, txn.Insert(200, -1))
+	storage.failing = true
+	// deletion fails in the middle, after it could change some nodes
+	assert.ErrorIs(t, txn.Delete(0), errFailingStorage)
+	storage.failing = false
+	_, err = txn.Get(100)
+	assert.ErrorIs(t, err, ErrTxnFailed)
+	assert.ErrorIs(t, txn.Insert(110, 110), ErrTxnFailed)
+	err = txn.Commit()
+	assert.ErrorIs(t, err, ErrTxnFailed)
+	assert.ErrorIs(t, err, errFailingStorage)
+	assert.ErrorIs(t, txn.Rollback(), ErrTxnDone)
+	for i := 100; i < 110; i++ {
+		_, err := tree.Get(i)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	txn = tree.Begin()
+	assert.Error(t, txn.Insert(200, -1))
+	assert.NoError(t, txn.Insert(200, 200))
+	assert.NoError(t, txn.Commit())
+	value, err := tree.Get(200)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, value)
+}
+
+func TestTree_Verify(t *testing.T) {
+	t.Parallel()
+	const a, b uint = 2, 3
+	leftmostLeaf := func(storage *InMemoryStorage[int, int]) Node[int, int] {
+		node := storage.nodes[rootId]
+		for !node.leaf {
+			node = storage.nodes[node.children[0]]
+		}
+		return node
+	}
+	type Scenario struct {
+		Name          string
+		Corrupt       func(storage *InMemoryStorage[int, int])
+		ExpectedKinds []ViolationKind
+	}
+	scenarios := []Scenario{
+		{
+			Name:    "valid",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {},
+		},
+		{
+			Name: "unsorted keys",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				root := storage.nodes[rootId]
+				root.values[0], root.values[1] = root.values[1], root.values[0]
+			},
+			ExpectedKinds: []ViolationKind{ViolationUnsortedKeys, ViolationSeparatorOrder},
+		},
+		{
+			Name: "separator order",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				leftmostLeaf(storage).values[0].First = -1000
+				leaf := leftmostLeaf(storage)
+				leaf.values[len(leaf.values)-1].First = 1000
+			},
+			ExpectedKinds: []ViolationKind{ViolationSeparatorOrder},
+		},
+		{
+			Name: "value count",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				leaf := leftmostLeaf(storage)
+				leaf.values = leaf.values[:0]
+				storage.nodes[leaf.id] = leaf
+			},
+			ExpectedKinds: []ViolationKind{ViolationValueCount},
+		},
+		{
+			Name: "leaf depth",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				storage.depth++
+			},
+			ExpectedKinds: []ViolationKind{ViolationLeafDepth},
+		},
+		{
+			Name: "missing node",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				delete(storage.nodes, storage.nodes[rootId].children[1])
+			},
+			ExpectedKinds: []ViolationKind{ViolationReachableFree},
+		},
+		{
+			Name: "shared node",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				root := storage.nodes[rootId]
+				root.children[1] = root.children[0]
+			},
+			ExpectedKinds: []ViolationKind{ViolationSharedNode},
+		},
+		{
+			Name: "subtree count",
+			Corrupt: func(storage *InMemoryStorage[int, int]) {
+				storage.nodes[rootId].counts[0]++
+			},
+			ExpectedKinds: []ViolationKind{ViolationSubtreeCount},
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			tree, storage := createTreeWithInMemoryStorage[int, int](a, b)
+			for i := 0; i < 30; i++ {
+				if err := tree.Insert(i, i); err != nil {
+					t.Fatalf("failed inserting value: %s", err)
+				}
+			}
+			scenario.Corrupt(storage)
+			report, err := tree.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			kinds := make(map[ViolationKind]struct{})
+			for _, violation := range report.Violations {
+				kinds[violation.Kind] = struct{}{}
+			}
+			assert.Equal(t, len(scenario.ExpectedKinds) == 0, report.Valid(), report.Violations)
+			for _, kind := range scenario.ExpectedKinds {
+				assert.Contains(t, kinds, kind, report.Violations)
+			}
+			if len(scenario.ExpectedKinds) == 0 {
+				assert.Equal(t, 30, report.Values)
+			}
+		})
+	}
+}
+
+// uncountedStorage
+// Storage which does not keep counts of values in subtrees.
+type uncountedStorage[K cmp.Ordered, V any] struct {
+	NodeStorage[K, V]
+}
+
+func (u uncountedStorage[K, V]) CountsSubtrees() bool {
+	return false
+}
+
+func TestTree_OrderStatistics(t *testing.T) {
+	t.Parallel()
+	const a, b, count = 2, 3, 200
+	type Scenario struct {
+		Name    string
+		Storage func(t *testing.T) NodeStorage[int64, int64]
+		Counted bool
+	}
+	scenarios := []Scenario{
+		{
+			Name: "in memory",
+			Storage: func(t *testing.T) NodeStorage[int64, int64] {
+				return InMemory[int64, int64](b)
+			},
+			Counted: true,
+		},
+		{
+			Name: "persistent",
+			Storage: func(t *testing.T) NodeStorage[int64, int64] {
+				storage, _ := createPersistentStorage(t, a, b)
+				return storage
+			},
+			Counted: true,
+		},
+		{
+			Name: "cached write back",
+			Storage: func(t *testing.T) NodeStorage[int64, int64] {
+				storage, _ := createPersistentStorage(t, a, b)
+				cached, err := NewCachedStorage[int64, int64](storage, 8, WriteBack)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return cached
+			},
+			Counted: true,
+		},
+		{
+			Name: "without counts",
+			Storage: func(t *testing.T) NodeStorage[int64, int64] {
+				return uncountedStorage[int64, int64]{InMemory[int64, int64](b)}
+			},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+			storage := scenario.Storage(t)
+			tree, err := NewTree[int64, int64](a, b, storage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			length, err := tree.Len()
+			assert.NoError(t, err)
+			assert.Zero(t, length)
+			_, _, err = tree.Min()
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, _, err = tree.At(0)
+			assert.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			// only even keys are stored
+			stored := make(map[int64]struct{})
+			for i := int64(0); i < count; i++ {
+				key := i * 7919 % count * 2
+				assert.NoError(t, tree.Insert(key, -key))
+				stored[key] = struct{}{}
+			}
+			for i := int64(0); i < count; i += 3 {
+				assert.NoError(t, tree.Delete(i*2))
+				delete(stored, i*2)
+			}
+			// replacing value and deleting missing key do not change counts
+			assert.NoError(t, tree.Insert(2, -2))
+			assert.NoError(t, tree.Delete(1))
+			txn := tree.Begin()
+			assert.NoError(t, txn.Insert(2*count, -2*count))
+			assert.NoError(t, txn.Delete(4))
+			assert.NoError(t, txn.Commit())
+			stored[2*count] = struct{}{}
+			delete(stored, 4)
+			keys := slices.Sorted(maps.Keys(stored))
+
+			report, err := tree.Verify()
+			if assert.NoError(t, err) {
+				assert.Empty(t, report.Violations)
+			}
+			root, err := storage.GetRoot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, scenario.Counted, root.counts != nil)
+
+			length, err = tree.Len()
+			assert.NoError(t, err)
+			assert.Equal(t, uint(len(keys)), length)
+			key, value, err := tree.Min()
+			assert.NoError(t, err)
+			assert.Equal(t, keys[0], key)
+			assert.Equal(t, -keys[0], value)
+			key, value, err = tree.Max()
+			assert.NoError(t, err)
+			assert.Equal(t, keys[len(keys)-1], key)
+			assert.Equal(t, -keys[len(keys)-1], value)
+			for index, expected := range keys {
+				key, value, err := tree.At(uint(index))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, key)
+				assert.Equal(t, -expected, value)
+
+				rank, err := tree.Rank(expected)
+				assert.NoError(t, err)
+				assert.Equal(t, uint(index), rank)
+				// odd keys are not stored and follow stored key
+				rank, err = tree.Rank(expected + 1)
+				assert.NoError(t, err)
+				assert.Equal(t, uint(index+1), rank)
+			}
+			rank, err := tree.Rank(-1)
+			assert.NoError(t, err)
+			assert.Zero(t, rank)
+			_, _, err = tree.At(uint(len(keys)))
+			assert.ErrorIs(t, err, ErrIndexOutOfRange)
+		})
+	}
+}
+
+// persistCountingStorage
+// Counts how many times every node was persisted.
+type persistCountingStorage[K cmp.Ordered, V any] struct {
+	NodeStorage[K, V]
+	persisted map[uint]int
+}
+
+func (p *persistCountingStorage[K, V]) Persist(node Node[K, V]) error {
+	p.persisted[node.id]++
+	return p.NodeStorage.Persist(node)
+}
+
+func TestBulkLoad(t *testing.T) {
+	t.Parallel()
+	type Scenario struct {
+		A, B       uint
+		FillFactor float64
+		Count      int
+	}
+	var scenarios []Scenario
+	for _, ab := range [][2]uint{{2, 3}, {3, 5}, {4, 9}} {
+		for _, fillFactor := range []float64{0.1, 0.5, 0.75, 1} {
+			for _, count := range []int{0, 1, 2, 5, 8, 9, 10, 100, 1234} {
+				scenarios = append(scenarios, Scenario{A: ab[0], B: ab[1], FillFactor: fillFactor, Count: count})
+			}
+		}
+	}
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(fmt.Sprintf("(%d,%d) fill %.2f count %d", scenario.A, scenario.B, scenario.FillFactor, scenario.Count),
+			func(t *testing.T) {
+				t.Parallel()
+				storage := &persistCountingStorage[int, int]{
+					NodeStorage: InMemory[int, int](scenario.B),
+					persisted:   make(map[uint]int),
+				}
+				tree, err := BulkLoad[int, int](scenario.A, scenario.B, scenario.FillFactor, storage,
+					func(yield func(int, int) bool) {
+						for i := 0; i < scenario.Count; i++ {
+							if !yield(i*2, i) {
+								return
+							}
+						}
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for id, count := range storage.persisted {
+					assert.Equal(t, 1, count, "node %d persisted more than once", id)
+				}
+				report, err := tree.Verify()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, report.Valid(), report.Violations)
+				assert.Equal(t, scenario.Count, report.Values)
+				for i := 0; i < scenario.Count; i++ {
+					value, err := tree.Get(i * 2)
+					assert.NoError(t, err)
+					assert.Equal(t, i, value)
+				}
+				// tree stays usable
+				for i := 0; i < scenario.Count; i++ {
+					assert.NoError(t, tree.Insert(i*2+1, -i))
+				}
+				for i := 0; i < scenario.Count; i += 2 {
+					assert.NoError(t, tree.Delete(i*2))
+				}
+				report, err = tree.Verify()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, report.Valid(), report.Violations)
+				assert.Equal(t, scenario.Count*2-(scenario.Count+1)/2, report.Values)
+			})
+	}
+
+	t.Run("unsorted input", func(t *testing.T) {
+		t.Parallel()
+		_, err := BulkLoad[int, int](2, 3, 1, InMemory[int, int](3), func(yield func(int, int) bool) {
+			_ = yield(1, 1) && yield(3, 3) && yield(2, 2)
+		})
+		assert.ErrorIs(t, err, ErrUnsortedInput)
+	})
+	t.Run("not empty storage", func(t *testing.T) {
+		t.Parallel()
+		tree, storage := createTreeWithInMemoryStorage[int, int](2, 3)
+		assert.NoError(t, tree.Insert(1, 1))
+		_, err := BulkLoad[int, int](2, 3, 1, storage, maps.All(map[int]int{}))
+		assert.ErrorIs(t, err, ErrStorageNotEmpty)
+	})
+}
@@ -0,0 +1,256 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"math/bits"
+	"slices"
+
+	"github.com/zelezo001/eternal/internal/stack"
+)
+
+var (
+	ErrTxnDone   = errors.New("transaction has already been committed or rolled back")
+	ErrTxnFailed = errors.New("transaction failed, it can only be rolled back")
+)
+
+// Txn
+// Group of tree operations which are applied all at once by Commit or discarded by Rollback.
+// Changed nodes are kept in memory until Commit. Tree must not be modified by other means while transaction is active.
+// Operation failing in the middle can leave transaction inconsistent, so transaction fails with it and all following
+// operations and Commit return ErrTxnFailed together with the original error.
+type Txn[K cmp.Ordered, V any] struct {
+	tree    *Tree[K, V]
+	view    *Tree[K, V] // tree operating over overlay, sees changes done in transaction
+	overlay *overlayStorage[K, V]
+	done    bool
+	err     error // error of operation which failed the transaction
+}
+
+// Begin
+// Starts new transaction over tree.
+func (t *Tree[K, V]) Begin() *Txn[K, V] {
+	overlay := &overlayStorage[K, V]{
+		base:    t.storage,
+		nodes:   make(map[uint]Node[K, V]),
+		removed: make(map[uint]struct{}),
+		freed:   stack.NewStack[uint](0),
+		depth:   t.storage.GetDepth(),
+		nextId:  firstProvisionalId,
+	}
+	return &Txn[K, V]{
+		tree: t,
+		view: &Tree[K, V]{
+			a:       t.a,
+			b:       t.b,
+			depth:   overlay.depth,
+			storage: overlay,
+			counted: t.counted,
+		},
+		overlay: overlay,
+	}
+}
+
+// Get
+// Returns value by given key including changes done in transaction. If value is not present, ErrNotFound is returned.
+func (x *Txn[K, V]) Get(key K) (V, error) {
+	if err := x.check(); err != nil {
+		var emptyValue V
+		return emptyValue, err
+	}
+	return x.view.Get(key)
+}
+
+// Insert
+// Stores value under given key in transaction. Value rejected by ValueChecker does not fail the transaction.
+func (x *Txn[K, V]) Insert(key K, value V) error {
+	if err := x.check(); err != nil {
+		return err
+	}
+	if err := checkValue(x.view.storage, key, value); err != nil {
+		return err
+	}
+	return x.fail(x.view.insert(key, value))
+}
+
+// Delete
+// Removes value stored under given key in transaction.
+func (x *Txn[K, V]) Delete(key K) error {
+	if err := x.check(); err != nil {
+		return err
+	}
+	return x.fail(x.view.delete(key))
+}
+
+// Commit
+// Writes all changes done in transaction to the storage of the tree. Changes are applied all or nothing only when
+// storage makes batches atomic, e.g. PersistentStorage with write-ahead log. Other storages (including
+// PersistentStorage without log, whose Begin does nothing) get changes one by one, so error returned in the middle
+// of commit can leave part of them applied. Failed transaction is not applied, its error is returned.
+func (x *Txn[K, V]) Commit() error {
+	if x.done {
+		return ErrTxnDone
+	}
+	x.done = true
+	if x.err != nil {
+		return errors.Join(ErrTxnFailed, x.err)
+	}
+	err := x.tree.atomically(x.overlay.apply)
+	x.tree.depth = x.tree.storage.GetDepth()
+	return err
+}
+
+// Rollback
+// Discards all changes done in transaction, nothing is written to the storage of the tree.
+func (x *Txn[K, V]) Rollback() error {
+	if x.done {
+		return ErrTxnDone
+	}
+	x.done = true
+	return nil
+}
+
+// check
+// Returns error if transaction cannot be used anymore.
+func (x *Txn[K, V]) check() error {
+	if x.done {
+		return ErrTxnDone
+	}
+	if x.err != nil {
+		return errors.Join(ErrTxnFailed, x.err)
+	}
+	return nil
+}
+
+// fail
+// Fails transaction if operation returned error.
+func (x *Txn[K, V]) fail(err error) error {
+	x.err = err
+	return err
+}
+
+// firstProvisionalId
+// New nodes of transaction get provisional ids from the upper half of ids, which is never reached by storages.
+const firstProvisionalId uint = 1 << (bits.UintSize - 1)
+
+// overlayStorage
+// Copy-on-write layer over storage. Nodes loaded from base storage are copied, so changes do not leak to base storage
+// until apply is called. New nodes get provisional ids, they are replaced by ids allocated from base storage in apply.
+type overlayStorage[K cmp.Ordered, V any] struct {
+	base    NodeStorage[K, V]
+	rootId  *uint
+	nodes   map[uint]Node[K, V] // nodes persisted in transaction
+	removed map[uint]struct{}   // nodes removed in transaction
+	freed   *stack.Stack[uint]  // ids removed in transaction, which can be reused
+	depth   uint
+	nextId  uint // next provisional id
+}
+
+var _ NodeStorage[string, any] = &overlayStorage[string, any]{}
+
+func (o *overlayStorage[K, V]) GetRoot() (Node[K, V], error) {
+	if o.rootId == nil {
+		root, err := o.base.GetRoot()
+		if err != nil {
+			return Node[K, V]{}, err
+		}
+		o.rootId = &root.id
+	}
+	return o.Get(*o.rootId)
+}
+
+func (o *overlayStorage[K, V]) GetDepth() uint {
+	return o.depth
+}
+
+func (o *overlayStorage[K, V]) SetDepth(depth uint) error {
+	o.depth = depth
+	return nil
+}
+
+func (o *overlayStorage[K, V]) Get(id uint) (Node[K, V], error) {
+	if node, found := o.nodes[id]; found {
+		return node, nil
+	}
+	if _, removed := o.removed[id]; removed {
+		return Node[K, V]{}, ErrMissingNode
+	}
+	node, err := o.base.Get(id)
+	if err != nil {
+		return Node[K, V]{}, err
+	}
+	// base storage can share slices with returned node, tree changes them in place
+	return node.clone(), nil
+}
+
+func (o *overlayStorage[K, V]) Persist(node Node[K, V]) error {
+	o.nodes[node.id] = node
+	return nil
+}
+
+func (o *overlayStorage[K, V]) Remove(id uint) error {
+	delete(o.nodes, id)
+	o.removed[id] = struct{}{}
+	o.freed.Push(id)
+	return nil
+}
+
+func (o *overlayStorage[K, V]) NewId() (uint, error) {
+	if !o.freed.Empty() {
+		id := o.freed.Pop()
+		delete(o.removed, id)
+		return id, nil
+	}
+	id := o.nextId
+	o.nextId++
+	return id, nil
+}
+
+func (o *overlayStorage[K, V]) CheckValue(key K, value V) error {
+	return checkValue(o.base, key, value)
+}
+
+// apply
+// Writes changes to base storage. Ids of new nodes are allocated after removed nodes are released, so they can
+// reuse their slots.
+func (o *overlayStorage[K, V]) apply() error {
+	for _, id := range slices.Sorted(maps.Keys(o.removed)) {
+		// provisional ids of nodes removed in transaction were never allocated in base storage
+		if id >= firstProvisionalId {
+			continue
+		}
+		if err := o.base.Remove(id); err != nil {
+			return err
+		}
+	}
+	ids := make(map[uint]uint)
+	for _, id := range slices.Sorted(maps.Keys(o.nodes)) {
+		if id < firstProvisionalId {
+			continue
+		}
+		allocated, err := o.base.NewId()
+		if err != nil {
+			return err
+		}
+		ids[id] = allocated
+	}
+	for _, id := range slices.Sorted(maps.Keys(o.nodes)) {
+		node := o.nodes[id]
+		if allocated, found := ids[id]; found {
+			node.id = allocated
+		}
+		for i, child := range node.children {
+			if allocated, found := ids[child]; found {
+				node.children[i] = allocated
+			}
+		}
+		if err := o.base.Persist(node); err != nil {
+			return err
+		}
+	}
+	if o.depth != o.base.GetDepth() {
+		return o.base.SetDepth(o.depth)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package eternal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+)
+
+// ViolationKind
+// Category of problem found by Tree.Verify or PersistentStorage.Check.
+type ViolationKind uint8
+
+const (
+	// ViolationUnreadableNode node referenced by its parent is missing or corrupted
+	ViolationUnreadableNode ViolationKind = iota
+	// ViolationSharedNode node is referenced more than once
+	ViolationSharedNode
+	// ViolationValueCount node has less than a-1 or more than b-1 values
+	ViolationValueCount
+	// ViolationChildCount inner node does not have exactly one child more than values
+	ViolationChildCount
+	// ViolationLeafDepth leaf is not on the depth of the tree
+	ViolationLeafDepth
+	// ViolationUnsortedKeys keys in node are not strictly ascending
+	ViolationUnsortedKeys
+	// ViolationSeparatorOrder key in node is not between separators of its parent
+	ViolationSeparatorOrder
+	// ViolationFreeChain free id chain references node in use, id outside of file or contains cycle
+	ViolationFreeChain
+	// ViolationReachableFree node is reachable from root and free at the same time
+	ViolationReachableFree
+	// ViolationSubtreeCount count of values in subtree of child stored in node differs from the actual one
+	ViolationSubtreeCount
+)
+
+func (v ViolationKind) String() string {
+	switch v {
+	case ViolationUnreadableNode:
+		return "unreadable node"
+	case ViolationSharedNode:
+		return "shared node"
+	case ViolationValueCount:
+		return "value count"
+	case ViolationChildCount:
+		return "child count"
+	case ViolationLeafDepth:
+		return "leaf depth"
+	case ViolationUnsortedKeys:
+		return "unsorted keys"
+	case ViolationSeparatorOrder:
+		return "separator order"
+	case ViolationFreeChain:
+		return "free chain"
+	case ViolationReachableFree:
+		return "reachable free node"
+	case ViolationSubtreeCount:
+		return "subtree count"
+	default:
+		return fmt.Sprintf("violation %d", uint8(v))
+	}
+}
+
+// Violation
+// Single problem found in stored tree.
+type Violation struct {
+	Kind    ViolationKind
+	NodeId  uint
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s in node %d: %s", v.Kind, v.NodeId, v.Message)
+}
+
+// Report
+// Result of verification. Tree is valid if no violation was found.
+type Report struct {
+	Nodes, Values int
+	Depth         uint
+	Violations    []Violation
+}
+
+// Valid
+// Returns true if no violation was found.
+func (r *Report) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *Report) add(kind ViolationKind, nodeId uint, format string, args ...any) {
+	r.Violations = append(r.Violations, Violation{Kind: kind, NodeId: nodeId, Message: fmt.Sprintf(format, args...)})
+}
+
+// Verify
+// Walks whole tree and checks (a,b)-tree invariants. Every found violation is stored in returned report,
+// error is returned only if verification could not be finished due to storage failure.
+// Tree must not be modified during verification.
+func (t *Tree[K, V]) Verify() (*Report, error) {
+	report, _, err := verifyTree(t.storage, t.a, t.b)
+	return report, err
+}
+
+// verifyTree
+// Verifies tree stored in storage and returns ids of all reachable nodes.
+func verifyTree[K cmp.Ordered, V any](storage NodeStorage[K, V], a, b uint) (*Report, map[uint]struct{}, error) {
+	v := &verifier[K, V]{
+		storage:   storage,
+		a:         a,
+		b:         b,
+		report:    &Report{Depth: storage.GetDepth()},
+		reachable: make(map[uint]struct{}),
+	}
+	root, err := storage.GetRoot()
+	if err != nil {
+		if !isNodeDamaged(err) {
+			return nil, nil, err
+		}
+		v.report.add(ViolationUnreadableNode, rootId, "could not load root: %s", err)
+		return v.report, v.reachable, nil
+	}
+	if _, err := v.verifyNode(root, 1, nil, nil); err != nil {
+		return nil, nil, err
+	}
+	return v.report, v.reachable, nil
+}
+
+func isNodeDamaged(err error) bool {
+	return errors.Is(err, ErrMissingNode) || errors.Is(err, ErrCorruptedNode)
+}
+
+type verifier[K cmp.Ordered, V any] struct {
+	storage   NodeStorage[K, V]
+	a, b      uint
+	report    *Report
+	reachable map[uint]struct{}
+}
+
+// verifyNode
+// Checks node and its subtree. Keys of the subtree must be greater than lower and lesser than upper, nil means unbounded.
+// Returns number of values found in the subtree.
+func (v *verifier[K, V]) verifyNode(node Node[K, V], depth uint, lower, upper *K) (uint, error) {
+	v.reachable[node.id] = struct{}{}
+	v.report.Nodes++
+	v.report.Values += len(node.values)
+
+	isRoot := depth == 1
+	valueCount := uint(len(node.values))
+	switch {
+	case valueCount > v.b-1:
+		v.report.add(ViolationValueCount, node.id, "node has %d values, at most %d allowed", valueCount, v.b-1)
+	case !isRoot && valueCount < v.a-1:
+		v.report.add(ViolationValueCount, node.id, "node has %d values, at least %d required", valueCount, v.a-1)
+	case isRoot && !node.leaf && valueCount == 0:
+		v.report.add(ViolationValueCount, node.id, "inner root has no values")
+	}
+	if !node.leaf && len(node.children) != len(node.values)+1 {
+		v.report.add(ViolationChildCount, node.id, "node has %d values but %d children", len(node.values),
+			len(node.children))
+	}
+	if node.counts != nil && len(node.counts) != len(node.children) {
+		v.report.add(ViolationSubtreeCount, node.id, "node has %d children but %d subtree counts", len(node.children),
+			len(node.counts))
+	}
+	if node.leaf && depth != v.report.Depth {
+		v.report.add(ViolationLeafDepth, node.id, "leaf is on depth %d, tree has depth %d", depth, v.report.Depth)
+	}
+	if !node.leaf && depth >= v.report.Depth {
+		v.report.add(ViolationLeafDepth, node.id, "inner node is on depth %d, tree has depth %d", depth,
+			v.report.Depth)
+		// children would be deeper than the tree, no need to descend further
+		return uint(len(node.values)), nil
+	}
+	for i, value := range node.values {
+		if i > 0 && node.values[i-1].First >= value.First {
+			v.report.add(ViolationUnsortedKeys, node.id, "key on position %d is not greater than its predecessor", i)
+		}
+		if (lower != nil && value.First <= *lower) || (upper != nil && value.First >= *upper) {
+			v.report.add(ViolationSeparatorOrder, node.id, "key on position %d is outside of parent separators", i)
+		}
+	}
+	size := uint(len(node.values))
+	for i, childId := range node.children {
+		if _, visited := v.reachable[childId]; visited {
+			v.report.add(ViolationSharedNode, childId, "node is referenced again by node %d", node.id)
+			continue
+		}
+		child, err := v.storage.Get(childId)
+		if err != nil {
+			if !isNodeDamaged(err) {
+				return 0, err
+			}
+			kind := ViolationUnreadableNode
+			if errors.Is(err, ErrMissingNode) {
+				kind = ViolationReachableFree
+			}
+			v.report.add(kind, childId, "child of node %d could not be loaded: %s", node.id, err)
+			continue
+		}
+		childLower, childUpper := lower, upper
+		if i > 0 && i-1 < len(node.values) {
+			childLower = &node.values[i-1].First
+		}
+		if i < len(node.values) {
+			childUpper = &node.values[i].First
+		}
+		childSize, err := v.verifyNode(child, depth+1, childLower, childUpper)
+		if err != nil {
+			return 0, err
+		}
+		if len(node.counts) == len(node.children) && node.counts[i] != childSize {
+			v.report.add(ViolationSubtreeCount, node.id, "child on position %d has %d values in subtree, %d stored",
+				i, childSize, node.counts[i])
+		}
+		size += childSize
+	}
+	return size, nil
+}